@@ -0,0 +1,679 @@
+package dragontoothmg
+
+// Position analysis helpers. These are built on top of the move generator and
+// Apply(), and are not performance-critical.
+
+import (
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+// Finds the single legal move that transforms the before board into the after board.
+// Only piece placement and the side to move are compared; the move clocks, the
+// en passant square and the castling rights of the after board are ignored.
+// Returns an error if no legal move, or more than one, produces the after board.
+func DeriveMove(before, after *Board) (Move, error) {
+	var found Move
+	matches := 0
+	moves := before.GenerateLegalMoves()
+	for _, m := range moves {
+		unapply := before.Apply(m)
+		if before.Wtomove == after.Wtomove && piecesEqual(before, after) {
+			found = m
+			matches++
+		}
+		unapply()
+	}
+	if matches == 0 {
+		return 0, errors.New("No legal move connects the two positions.")
+	}
+	if matches > 1 {
+		return 0, errors.New("Multiple legal moves connect the two positions.")
+	}
+	return found, nil
+}
+
+// Finds the move that was just played, for GUIs that know the FEN before the move
+// and the board after it. Like DeriveMove(), only piece placement and the side to
+// move are compared, and an error is returned if the FEN is invalid or no single
+// legal move connects the positions.
+func PlayedMove(beforeFEN string, after *Board) (Move, error) {
+	before, err := ParseFenSafe(beforeFEN)
+	if err != nil {
+		return 0, err
+	}
+	return DeriveMove(&before, after)
+}
+
+// Whether two boards have identical piece placement.
+func piecesEqual(a, b *Board) bool {
+	return a.White == b.White && a.Black == b.Black
+}
+
+// Returns a copy of the board with the other side to move, for analysis such as
+// examining the opponent's threats. Unlike a null move, the move clocks are left
+// untouched. The en passant square is cleared, since it would refer to the side
+// that was to move. The resulting position may be illegal (for example, the new
+// side to move may be giving check), so it should only be used for analysis.
+// The copy does not track repetitions.
+func (b *Board) WithSideToMoveFlipped() Board {
+	flipped := b.detachedCopy()
+	flipped.Wtomove = !flipped.Wtomove
+	flipped.hash ^= whiteToMoveZobristC
+	flipped.hash ^= uint64(flipped.enpassant)
+	flipped.enpassant = 0
+	return flipped
+}
+
+// Checks that the position could arise in a game: each side has exactly one king,
+// the side not to move is not in check, no pawns stand on the first or last rank,
+// each castling right has its king and rook on their home squares, and the en
+// passant square follows a double pawn push. Returns false and an error describing
+// the first problem found.
+func (b *Board) IsValidPosition() (bool, error) {
+	if bits.OnesCount64(b.White.Kings) != 1 || bits.OnesCount64(b.Black.Kings) != 1 {
+		return false, errors.New("Each side must have exactly one king.")
+	}
+	if b.AttackersTo(b.kingSquare(!b.Wtomove), b.Wtomove) != 0 {
+		return false, errors.New("The side not to move is in check.")
+	}
+	if (b.White.Pawns|b.Black.Pawns)&(onlyRank[0]|onlyRank[7]) != 0 {
+		return false, errors.New("Pawns cannot stand on the first or last rank.")
+	}
+	if b.EffectiveCastlingRights() != b.CastlingRights() {
+		return false, errors.New("Castling rights do not match the king and rook placement.")
+	}
+	if b.enpassant != 0 {
+		ep := b.enpassant
+		var pawns uint64
+		var pawnSquare, originSquare uint8
+		if b.Wtomove { // black just made a double push
+			pawns, pawnSquare, originSquare = b.Black.Pawns, ep-8, ep+8
+		} else {
+			pawns, pawnSquare, originSquare = b.White.Pawns, ep+8, ep-8
+		}
+		if (b.Wtomove && ep/8 != 5) || (!b.Wtomove && ep/8 != 2) ||
+			pawns&(uint64(1)<<pawnSquare) == 0 ||
+			(b.White.All|b.Black.All)&((uint64(1)<<ep)|(uint64(1)<<originSquare)) != 0 {
+			return false, errors.New("The en passant square does not follow a double pawn push.")
+		}
+	}
+	return true, nil
+}
+
+// Returns the castling rights that could still be used, given the piece placement:
+// rights whose king or rook is not on its home square are left out. Unlike
+// SetCastlingRights(), the board is not changed.
+func (b *Board) EffectiveCastlingRights() CastleRights {
+	var effective CastleRights
+	for _, r := range [...]CastleRights{WhiteQueenside, WhiteKingside, BlackQueenside, BlackKingside} {
+		if b.CastlingRights()&r != 0 && b.castleRightConsistent(r) {
+			effective |= r
+		}
+	}
+	return effective
+}
+
+// Whether the king and rook for a castling right are on their home squares. For a
+// right given by a rook file in a Chess960 FEN, the king may be anywhere on its
+// home rank.
+func (b *Board) castleRightConsistent(r CastleRights) bool {
+	pieces, backRank := &(b.White), onlyRank[0]
+	if r&(BlackQueenside|BlackKingside) != 0 {
+		pieces, backRank = &(b.Black), onlyRank[7]
+	}
+	rookFile := 7
+	if r&(WhiteQueenside|BlackQueenside) != 0 {
+		rookFile = 0
+	}
+	kingHome := backRank & onlyFile[4]
+	if file := b.castleFiles[bits.TrailingZeros8(uint8(r))]; file != 0 {
+		rookFile = int(file) - 1
+		kingHome = backRank
+	}
+	return pieces.Kings&kingHome != 0 && pieces.Rooks&backRank&onlyFile[rookFile] != 0
+}
+
+// Returns the color-mirrored board: every piece changes color and moves to the
+// same file on the opposite rank, the other side is to move, and the castling
+// rights and en passant square are mirrored to match. The move clocks are kept.
+// Evaluations of a position and its mirror should be equal and opposite.
+func (b *Board) Mirror() Board {
+	var mirrored Board
+	mirrored.Wtomove = !b.Wtomove
+	mirrored.White = mirrorBitboards(&(b.Black))
+	mirrored.Black = mirrorBitboards(&(b.White))
+	if b.enpassant != 0 {
+		mirrored.enpassant = b.enpassant ^ 56
+	}
+	mirrored.castlerights = (b.castlerights >> 2) | ((b.castlerights & 3) << 2)
+	mirrored.castleFiles = [4]uint8{b.castleFiles[2], b.castleFiles[3], b.castleFiles[0], b.castleFiles[1]}
+	mirrored.Halfmoveclock = b.Halfmoveclock
+	mirrored.Fullmoveno = b.Fullmoveno
+	mirrored.hash = recomputeBoardHash(&mirrored)
+	mirrored.material = -b.material
+	return mirrored
+}
+
+// Flips every bitboard of one side vertically, from rank 1 to rank 8.
+func mirrorBitboards(bb *Bitboards) Bitboards {
+	return Bitboards{
+		Pawns:   bits.ReverseBytes64(bb.Pawns),
+		Bishops: bits.ReverseBytes64(bb.Bishops),
+		Knights: bits.ReverseBytes64(bb.Knights),
+		Rooks:   bits.ReverseBytes64(bb.Rooks),
+		Queens:  bits.ReverseBytes64(bb.Queens),
+		Kings:   bits.ReverseBytes64(bb.Kings),
+		All:     bits.ReverseBytes64(bb.All),
+	}
+}
+
+// Whether two boards hold the same position: the same piece placement, side to
+// move, castling rights and en passant square. The move clocks are ignored.
+func (b *Board) EqualPosition(other *Board) bool {
+	return piecesEqual(b, other) && b.Wtomove == other.Wtomove &&
+		b.castlerights == other.castlerights && b.enpassant == other.enpassant
+}
+
+// Whether the position is the same as its color mirror (see Mirror()), apart from
+// the side to move, as in the starting position.
+func (b *Board) IsSymmetric() bool {
+	mirrored := b.Mirror()
+	mirrored.Wtomove = b.Wtomove
+	return b.EqualPosition(&mirrored)
+}
+
+// Whether the side to move has been checkmated.
+func (b *Board) IsCheckmate() bool {
+	return b.OurKingInCheck() && len(b.GenerateLegalMoves()) == 0
+}
+
+// Whether the side to move is stalemated.
+func (b *Board) IsStalemate() bool {
+	return !b.OurKingInCheck() && len(b.GenerateLegalMoves()) == 0
+}
+
+// Reports whether the side to move has any legal moves, and whether it is in check.
+// Together these distinguish a playable position from checkmate (no moves, in check)
+// and stalemate (no moves, not in check), without inspecting an empty move list.
+func (b *Board) NextMoveStatus() (hasMoves bool, inCheck bool) {
+	return len(b.GenerateLegalMoves()) != 0, b.OurKingInCheck()
+}
+
+// Returns the legal moves that leave the opponent stalemated: not in check, and
+// with no legal replies. The board is left unchanged.
+func (b *Board) StalematingMoves() []Move {
+	var stalemating []Move
+	for _, m := range b.GenerateLegalMoves() {
+		unapply := b.Apply(m)
+		if b.IsStalemate() {
+			stalemating = append(stalemating, m)
+		}
+		unapply()
+	}
+	return stalemating
+}
+
+// Returns, for each legal move, how many legal replies the opponent would have
+// after it. Moves that leave few replies are forcing; a count of 0 means the move
+// mates or stalemates. The board is left unchanged.
+func (b *Board) ReplyMobility() map[Move]int {
+	moves := b.GenerateLegalMoves()
+	mobility := make(map[Move]int, len(moves))
+	for _, m := range moves {
+		unapply := b.Apply(m)
+		mobility[m] = len(b.GenerateLegalMoves())
+		unapply()
+	}
+	return mobility
+}
+
+// Whether neither side has enough material to deliver checkmate: bare kings,
+// a single minor piece, or only bishops that all stand on squares of one color.
+func (b *Board) IsInsufficientMaterial() bool {
+	if b.White.Pawns|b.Black.Pawns|b.White.Rooks|b.Black.Rooks|b.White.Queens|b.Black.Queens != 0 {
+		return false
+	}
+	knights := b.White.Knights | b.Black.Knights
+	bishops := b.White.Bishops | b.Black.Bishops
+	if bits.OnesCount64(knights|bishops) <= 1 {
+		return true
+	}
+	return knights == 0 && (bishops&lightSquares == 0 || bishops & ^lightSquares == 0)
+}
+
+// Whether the position is a well-known fortress that cannot be won, though mating
+// material remains. Recognition is conservative: only the rook pawn with the
+// wrong bishop is recognized, where one side has its king and only rook pawns on
+// a single file, perhaps with bishops that cannot control the promotion square,
+// and the bare enemy king stands on or next to that square. A lone rook pawn is
+// the same fortress without the bishop.
+func (b *Board) IsKnownFortress() bool {
+	return b.rookPawnFortress(true) || b.rookPawnFortress(false)
+}
+
+// Whether the given side holds the fortress of IsKnownFortress() against the
+// other side's rook pawns.
+func (b *Board) rookPawnFortress(defenderWhite bool) bool {
+	attacker, defender := &(b.Black), &(b.White)
+	promotionRank := onlyRank[0]
+	if !defenderWhite {
+		attacker, defender = &(b.White), &(b.Black)
+		promotionRank = onlyRank[7]
+	}
+	if defender.All != defender.Kings || attacker.Knights|attacker.Rooks|attacker.Queens != 0 {
+		return false
+	}
+	var file uint64
+	switch {
+	case attacker.Pawns == 0:
+		return false
+	case attacker.Pawns&^onlyFile[0] == 0:
+		file = onlyFile[0]
+	case attacker.Pawns&^onlyFile[7] == 0:
+		file = onlyFile[7]
+	default:
+		return false
+	}
+	promotion := file & promotionRank
+	bishopColor := lightSquares
+	if promotion&lightSquares != 0 {
+		bishopColor = ^lightSquares
+	}
+	if attacker.Bishops&^bishopColor != 0 {
+		return false
+	}
+	defenderKing := Square(bits.TrailingZeros64(defender.Kings))
+	return KingDistance(defenderKing, Square(bits.TrailingZeros64(promotion))) <= 1
+}
+
+// Whether the position after the move has insufficient mating material, for
+// example because it captures the last pawn, so that the move forces a draw.
+func (b *Board) MoveLeadsToInsufficientMaterial(m Move) bool {
+	unapply := b.Apply(m)
+	insufficient := b.IsInsufficientMaterial()
+	unapply()
+	return insufficient
+}
+
+// Whether every legal move of the side to move is a king move, as in many bare
+// king endgames. This is also true if there are no legal moves at all.
+func (b *Board) OnlyKingMoves() bool {
+	ourKings := b.White.Kings
+	if !b.Wtomove {
+		ourKings = b.Black.Kings
+	}
+	for _, m := range b.GenerateLegalMoves() {
+		if (uint64(1)<<m.From())&ourKings == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the position is quiet: the side to move is not in check, and has no
+// legal capture (including en passant) or promotion. Quiescence search can stop
+// at quiet positions.
+func (b *Board) IsQuiet() bool {
+	if b.OurKingInCheck() {
+		return false
+	}
+	for _, m := range b.GenerateLegalMoves() {
+		if IsCapture(m, b) || m.Promote() != Nothing {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the move takes a pawn of the side to move to the last rank, which is
+// when a GUI should offer a promotion picker. The promotion piece of the move is
+// not checked, so this is true for a pawn move to the last rank that does not yet
+// name one. Whether the move is legal is not checked either.
+func (b *Board) IsPromotingMove(m Move) bool {
+	ourPawns, lastRank := b.White.Pawns, onlyRank[7]
+	if !b.Wtomove {
+		ourPawns, lastRank = b.Black.Pawns, onlyRank[0]
+	}
+	return ourPawns&(uint64(1)<<m.From()) != 0 && lastRank&(uint64(1)<<m.To()) != 0
+}
+
+// Whether the move captures a piece on the square the opponent's last move went
+// to, as when search extends recaptures. En passant captures land behind the
+// pawn, so they are never recaptures. A null last move has no destination.
+func (b *Board) IsRecapture(m Move, lastMove Move) bool {
+	if lastMove.IsNull() || m.To() != lastMove.To() {
+		return false
+	}
+	theirPieces := b.Black.All
+	if !b.Wtomove {
+		theirPieces = b.White.All
+	}
+	return theirPieces&(uint64(1)<<m.To()) != 0
+}
+
+// Returns the squares that the piece on the given square may legally move to, if it
+// is a piece of the side to move that is absolutely pinned to its king: those on
+// the pin ray, up to and including the pinning piece. Returns 0 if the piece is
+// pinned and cannot move at all, and also if it is not pinned.
+func (b *Board) PinnedPieceLegalMoves(s Square) uint64 {
+	var pinnedMoves []Move
+	if b.generatePinnedMoves(&pinnedMoves, everything)&(uint64(1)<<s) == 0 {
+		return 0
+	}
+	return b.LegalDestinationsFrom(s)
+}
+
+// Returns the moves for which keep returns true, in their original order.
+func FilterMoves(moves []Move, keep func(Move) bool) []Move {
+	var kept []Move
+	for _, m := range moves {
+		if keep(m) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// Returns the legal moves for which keep returns true. The keep function is given
+// the board, so it can use queries such as SEE(), but must leave it unchanged.
+func (b *Board) FilterLegalMoves(keep func(b *Board, m Move) bool) []Move {
+	return FilterMoves(b.GenerateLegalMoves(), func(m Move) bool {
+		return keep(b, m)
+	})
+}
+
+// Returns the opponent's legal replies to a move, leaving the board unchanged.
+// Returns an error if the move is not legal in the current position.
+func (b *Board) LegalRepliesTo(m Move) ([]Move, error) {
+	if !b.isLegalMove(m) {
+		return nil, errors.New("Move is not legal in this position: " + m.String())
+	}
+	unapply := b.Apply(m)
+	replies := b.GenerateLegalMoves()
+	unapply()
+	return replies, nil
+}
+
+// A legal move, along with the FEN of the position it leads to.
+type MoveWithFEN struct {
+	Move Move
+	FEN  string
+}
+
+// Returns every legal move together with the FEN of the resulting position, for
+// building position graphs and datasets. The board is left unchanged.
+func (b *Board) LegalMovesWithResultingFEN() []MoveWithFEN {
+	moves := b.GenerateLegalMoves()
+	results := make([]MoveWithFEN, len(moves))
+	for i, m := range moves {
+		unapply := b.Apply(m)
+		results[i] = MoveWithFEN{Move: m, FEN: b.ToFen()}
+		unapply()
+	}
+	return results
+}
+
+// The kind of a move, as classified by ClassifyMoves().
+type MoveInfo struct {
+	Move      Move
+	Capture   bool // true for en passant too
+	EnPassant bool
+	Promotion Piece        // the piece promoted to, or Nothing
+	Castle    CastleRights // the right used, such as WhiteKingside, or 0 if not castling
+	Check     bool         // whether the move gives check
+}
+
+// Classifies each of the moves, which must be legal in the current position.
+func (b *Board) ClassifyMoves(moves []Move) []MoveInfo {
+	ourPieces := &(b.White)
+	kingside, queenside := WhiteKingside, WhiteQueenside
+	if !b.Wtomove {
+		ourPieces = &(b.Black)
+		kingside, queenside = BlackKingside, BlackQueenside
+	}
+	occupied := b.White.All | b.Black.All
+	infos := make([]MoveInfo, len(moves))
+	for i, m := range moves {
+		info := MoveInfo{Move: m, Promotion: m.Promote()}
+		pieceType, _ := determinePieceType(ourPieces, uint64(1)<<m.From())
+		info.Capture = IsCapture(m, b)
+		info.EnPassant = info.Capture && occupied&(uint64(1)<<m.To()) == 0
+		if pieceType == King && m.To() == m.From()+2 {
+			info.Castle = kingside
+		} else if pieceType == King && m.To()+2 == m.From() {
+			info.Castle = queenside
+		}
+		info.Check = b.givesCheck(m)
+		infos[i] = info
+	}
+	return infos
+}
+
+// Whether the move is one of the legal moves in the current position.
+func (b *Board) isLegalMove(m Move) bool {
+	for _, legal := range b.GenerateLegalMoves() {
+		if legal == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns how many of the moving side's pieces give check to the opponent's king
+// after the move: 0, 1, or 2 for a double check. The move is assumed to be legal.
+func (b *Board) ChecksGivenBy(m Move) int {
+	unapply := b.Apply(m)
+	checks := bits.OnesCount64(b.AttackersTo(b.kingSquare(b.Wtomove), !b.Wtomove))
+	unapply()
+	return checks
+}
+
+// Returns the legal moves that give check.
+func (b *Board) GenerateChecks() []Move {
+	return b.FilterLegalMoves(func(b *Board, m Move) bool {
+		return b.givesCheck(m)
+	})
+}
+
+// Whether the side to move has any legal move that gives check. This stops at the
+// first checking move found, so it is cheaper than GenerateChecks().
+func (b *Board) HasCheckGivingMove() bool {
+	for _, m := range b.GenerateLegalMoves() {
+		if b.givesCheck(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the legal move puts the opponent in check.
+func (b *Board) givesCheck(m Move) bool {
+	unapply := b.Apply(m)
+	check := b.OurKingInCheck()
+	unapply()
+	return check
+}
+
+// Returns the material signature of the position, as used to name endgame
+// tablebases: white's pieces, then "v", then black's pieces, each listed in the
+// order K, Q, R, B, N, P. For example, "KQvKR" or "KRPvKR".
+func (b *Board) EndgameSignature() string {
+	return materialSignature(&(b.White)) + "v" + materialSignature(&(b.Black))
+}
+
+// Lists the pieces on one side's bitboards, in tablebase order.
+func materialSignature(bb *Bitboards) string {
+	signature := strings.Repeat("K", bits.OnesCount64(bb.Kings))
+	signature += strings.Repeat("Q", bits.OnesCount64(bb.Queens))
+	signature += strings.Repeat("R", bits.OnesCount64(bb.Rooks))
+	signature += strings.Repeat("B", bits.OnesCount64(bb.Bishops))
+	signature += strings.Repeat("N", bits.OnesCount64(bb.Knights))
+	signature += strings.Repeat("P", bits.OnesCount64(bb.Pawns))
+	return signature
+}
+
+// The most pieces, kings included, for which Syzygy tablebases exist.
+const syzygyMaxMen = 7
+
+// Returns the name of the Syzygy tablebase holding the position, such as "KQvKR",
+// along with the side to move in that table's terms: 0 if the side listed first is
+// to move and 1 if the other side is. The side with more pieces is listed first,
+// and if both have the same number, the one with the stronger pieces; when the
+// sides are swapped, the position is probed with the colors mirrored. ok is
+// whether the position has few enough men for a table to exist. Castling rights
+// are not considered, though tables assume there are none.
+func (b *Board) SyzygyKey() (key string, stm int, ok bool) {
+	strong := materialSignature(&(b.White))
+	weak := materialSignature(&(b.Black))
+	strongToMove := b.Wtomove
+	if len(strong) < len(weak) || (len(strong) == len(weak) && strongerSignature(weak, strong)) {
+		strong, weak = weak, strong
+		strongToMove = !strongToMove
+	}
+	if !strongToMove {
+		stm = 1
+	}
+	return strong + "v" + weak, stm, len(strong)+len(weak) <= syzygyMaxMen
+}
+
+// Whether the first of two material signatures of the same length has the
+// stronger pieces, comparing them piece by piece in tablebase order.
+func strongerSignature(a, b string) bool {
+	const order = "KQRBNP"
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			return strings.IndexByte(order, a[i]) < strings.IndexByte(order, b[i])
+		}
+	}
+	return false
+}
+
+// Returns the fewest moves a lone piece of the given type needs to travel from
+// one square to the other on an otherwise empty board, and false if it can never
+// get there (such as a bishop heading for a square of the other color). Pawns
+// move toward the far rank of the side to move, and never capture.
+func (b *Board) ShortestPiecePath(from Square, to Square, p Piece) (int, bool) {
+	reached := uint64(1) << from
+	frontier := reached
+	for steps := 0; frontier != 0; steps++ {
+		if reached&(uint64(1)<<to) != 0 {
+			return steps, true
+		}
+		var next uint64
+		for x := frontier; x != 0; x &= x - 1 {
+			next |= emptyBoardSteps(Square(bits.TrailingZeros64(x)), p, b.Wtomove)
+		}
+		frontier = next &^ reached
+		reached |= frontier
+	}
+	return 0, false
+}
+
+// Returns the squares a piece of the given type can move to in one step from s on
+// an empty board.
+func emptyBoardSteps(s Square, p Piece, white bool) uint64 {
+	switch p {
+	case Pawn:
+		squareMask := uint64(1) << s
+		if white {
+			return squareMask<<8 | (squareMask&onlyRank[1])<<16
+		}
+		return squareMask>>8 | (squareMask&onlyRank[6])>>16
+	case Knight:
+		return knightMasks[s]
+	case Bishop:
+		return CalculateBishopMoveBitboard(uint8(s), 0)
+	case Rook:
+		return CalculateRookMoveBitboard(uint8(s), 0)
+	case Queen:
+		return CalculateBishopMoveBitboard(uint8(s), 0) | CalculateRookMoveBitboard(uint8(s), 0)
+	case King:
+		return kingMasks[s]
+	}
+	return 0
+}
+
+// Returns the moves the opponent could make if it were their turn, to show what
+// they are threatening. These moves are pseudo-legal: pins and checks against the
+// opponent's king are ignored, although the king never moves onto an attacked
+// square. Castling is not included. The current side to move is ignored entirely.
+func (b *Board) OpponentThreats() []Move {
+	flipped := b.WithSideToMoveFlipped()
+	moves := make([]Move, 0, kDefaultMoveListLength)
+	flipped.generatePseudoLegalMoves(&moves, AllPiecesMask)
+	return moves
+}
+
+// Returns the pseudo-legal moves of the side to move for the piece types in the
+// mask, ignoring pins and checks, for staged generation and specialized analysis.
+// King moves never step onto an attacked square, and castling is not included.
+// When the side to move is not in check and has no pinned pieces, AllPiecesMask
+// gives exactly the legal moves other than castling.
+func (b *Board) GenerateMovesForPieces(mask PieceMask) []Move {
+	moves := make([]Move, 0, kDefaultMoveListLength)
+	b.generatePseudoLegalMoves(&moves, mask)
+	return moves
+}
+
+// Appends the pseudo-legal moves of the side to move's pieces of the types in the
+// mask, ignoring pins and checks. Castling is not included.
+func (b *Board) generatePseudoLegalMoves(moves *[]Move, mask PieceMask) {
+	ourPiecesPtr := &(b.White)
+	if !b.Wtomove {
+		ourPiecesPtr = &(b.Black)
+	}
+	if mask.Contains(Pawn) {
+		b.pawnPushes(moves, everything, everything)
+		b.pawnCaptures(moves, everything, everything)
+	}
+	if mask.Contains(Knight) {
+		b.knightMoves(moves, everything, everything)
+	}
+	if mask.Contains(Rook) {
+		b.rookMoves(moves, everything, everything)
+	}
+	if mask.Contains(Bishop) {
+		b.bishopMoves(moves, everything, everything)
+	}
+	if mask.Contains(Queen) {
+		b.queenMoves(moves, everything, everything)
+	}
+	if mask.Contains(King) {
+		b.kingPushes(moves, ourPiecesPtr)
+	}
+}
+
+// Describes how the other board's piece placement differs from this one's. For
+// every square whose contents differ, removed holds the piece on this board, and
+// added holds the piece on the other board (for squares that are occupied).
+// A piece that is replaced by one of the other color appears in both maps.
+func (b *Board) Diff(other *Board) (added map[Square]Piece, removed map[Square]Piece) {
+	added = make(map[Square]Piece)
+	removed = make(map[Square]Piece)
+	for s := Square(0); s < 64; s++ {
+		ourPiece, ourWhite := b.pieceAt(s)
+		otherPiece, otherWhite := other.pieceAt(s)
+		if ourPiece == otherPiece && (ourPiece == Nothing || ourWhite == otherWhite) {
+			continue
+		}
+		if ourPiece != Nothing {
+			removed[s] = ourPiece
+		}
+		if otherPiece != Nothing {
+			added[s] = otherPiece
+		}
+	}
+	return added, removed
+}
+
+// Returns the piece on a square and whether it is white, or Nothing if the square is empty.
+func (b *Board) pieceAt(s Square) (Piece, bool) {
+	squareMask := uint64(1) << s
+	if piece, _ := determinePieceType(&(b.White), squareMask); piece != Nothing {
+		return piece, true
+	}
+	piece, _ := determinePieceType(&(b.Black), squareMask)
+	return piece, false
+}
@@ -0,0 +1,879 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestDeriveMove(t *testing.T) {
+	positions := map[string]string{
+		// ordinary move
+		Startpos: "e2e4",
+		// white castles short
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": "e1g1",
+		// black castles long
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 0": "e8c8",
+		// underpromotion
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1": "g2g1r",
+	}
+	for k, v := range positions {
+		before := ParseFen(k)
+		after := ParseFen(k)
+		after.Apply(parseMove(v))
+		move, err := DeriveMove(&before, &after)
+		if err != nil {
+			t.Error("Failed to derive move", v, "for position", k, ":", err)
+			continue
+		}
+		if move != parseMove(v) {
+			t.Error("Derived the wrong move for position", k, "\nExpected", v, "but got", &move)
+		}
+		if before.ToFen() != k {
+			t.Error("Deriving a move corrupted board state.")
+		}
+	}
+}
+
+func TestDeriveMoveNoMatch(t *testing.T) {
+	before := ParseFen(Startpos)
+	// the same position is not reachable in one move
+	same := ParseFen(Startpos)
+	if _, err := DeriveMove(&before, &same); err == nil {
+		t.Error("Derived a move between identical positions.")
+	}
+	// two moves apart
+	twoMoves := ParseFen(Startpos)
+	twoMoves.Apply(parseMove("e2e4"))
+	twoMoves.Apply(parseMove("e7e5"))
+	if _, err := DeriveMove(&before, &twoMoves); err == nil {
+		t.Error("Derived a move between positions two moves apart.")
+	}
+	// right placement, wrong side to move
+	wrongSide := ParseFen("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 1")
+	if _, err := DeriveMove(&before, &wrongSide); err == nil {
+		t.Error("Derived a move that leaves the wrong side to move.")
+	}
+}
+
+func TestPlayedMove(t *testing.T) {
+	moves := map[string]string{
+		Startpos: "g1f3",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": "d5e6",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3":        "e5f6",
+	}
+	for fen, v := range moves {
+		after := ParseFen(fen)
+		after.Apply(parseMove(v))
+		move, err := PlayedMove(fen, &after)
+		if err != nil || move != parseMove(v) {
+			t.Error("Wrong played move for", fen, "\nExpected", v, "but got", &move, err)
+		}
+	}
+	after := ParseFen(Startpos)
+	after.Apply(parseMove("e2e4"))
+	after.Apply(parseMove("e7e5"))
+	if _, err := PlayedMove(Startpos, &after); err == nil {
+		t.Error("Found a played move between positions two moves apart.")
+	}
+	if _, err := PlayedMove("not a fen", &after); err == nil {
+		t.Error("Found a played move from an invalid FEN.")
+	}
+}
+
+func TestWithSideToMoveFlipped(t *testing.T) {
+	b := ParseFen("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1")
+	flipped := b.WithSideToMoveFlipped()
+	if !flipped.Wtomove {
+		t.Error("Side to move was not flipped.")
+	}
+	if flipped.ToFen() != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 1" {
+		t.Error("Flipping the side to move produced the wrong position:", flipped.ToFen())
+	}
+	if flipped.Hash() != recomputeBoardHash(&flipped) {
+		t.Error("Flipping the side to move produced an inconsistent hash.")
+	}
+	if b.ToFen() != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1" {
+		t.Error("Flipping the side to move modified the original board.")
+	}
+	// white, not black, is now the side generating moves
+	moves := flipped.GenerateLegalMoves()
+	if len(moves) != 30 {
+		t.Error("Legal moves after flip: wrong length. Expected 30 but got", len(moves))
+	}
+	for _, m := range moves {
+		if uint64(1)<<m.From()&flipped.White.All == 0 {
+			t.Error("Generated a move for the wrong side after flipping:", &m)
+		}
+	}
+}
+
+func TestLegalRepliesTo(t *testing.T) {
+	positions := map[string]string{
+		Startpos: "e2e4",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": "e1g1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0":                            "e2e4",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1":     "c4c5",
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		replies, err := b.LegalRepliesTo(parseMove(v))
+		if err != nil {
+			t.Error("Failed to find replies to", v, "in position", k, ":", err)
+			continue
+		}
+		if b.ToFen() != k {
+			t.Error("Finding replies corrupted board state for", k)
+		}
+		manual := ParseFen(k)
+		manual.Apply(parseMove(v))
+		expected := manual.GenerateLegalMoves()
+		if len(replies) != len(expected) {
+			t.Error("Replies: wrong length. Expected", len(expected), "but got", len(replies), "for", k)
+			continue
+		}
+		for i := range expected {
+			if replies[i] != expected[i] {
+				t.Error("Replies differ from manual generation for", k)
+				break
+			}
+		}
+	}
+	b := ParseFen(Startpos)
+	if _, err := b.LegalRepliesTo(parseMove("e2e5")); err == nil {
+		t.Error("Found replies to an illegal move.")
+	}
+}
+
+func TestEndgameSignature(t *testing.T) {
+	positions := map[string]string{
+		"8/8/4k3/8/8/2K5/8/8 w - - 0 1":       "KvK",
+		"8/8/4k3/8/8/2KQ4/8/8 w - - 0 1":      "KQvK",
+		"8/8/3rk3/8/8/2KQ4/8/8 w - - 0 1":     "KQvKR",
+		"8/8/3rk3/8/4P3/2K5/5R2/8 b - - 0 1":  "KRPvKR",
+		"8/1n6/3bk3/8/8/2KB4/1B6/8 w - - 0 1": "KBBvKBN",
+		"8/pp6/4k3/8/8/2K5/6PP/4N3 w - - 0 1": "KNPPvKPP",
+		Startpos:                              "KQRRBBNNPPPPPPPPvKQRRBBNNPPPPPPPP",
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if sig := b.EndgameSignature(); sig != v {
+			t.Error("Wrong endgame signature for", k, "\nExpected", v, "but got", sig)
+		}
+	}
+}
+
+func TestSyzygyKey(t *testing.T) {
+	tests := []struct {
+		fen string
+		key string
+		stm int
+		ok  bool
+	}{
+		{"8/8/3rk3/8/8/2KQ4/8/8 w - - 0 1", "KQvKR", 0, true},
+		{"8/8/3rk3/8/8/2KQ4/8/8 b - - 0 1", "KQvKR", 1, true},
+		// black is the stronger side, so the colors are mirrored
+		{"8/8/3qk3/8/8/2KR4/8/8 w - - 0 1", "KQvKR", 1, true},
+		{"8/8/3rk3/8/4P3/2K5/5R2/8 b - - 0 1", "KRPvKR", 1, true},
+		// more pieces come first, even if they are weaker
+		{"8/8/2nbk3/8/8/2KR4/8/8 w - - 0 1", "KBNvKR", 1, true},
+		{"8/8/3bk3/8/8/2KN4/8/8 w - - 0 1", "KBvKN", 1, true},
+		{"8/8/3rk3/8/8/2KR4/8/8 b - - 0 1", "KRvKR", 1, true},
+		{"8/pp6/4k3/8/8/2K5/6PP/4N3 w - - 0 1", "KNPPvKPP", 0, true},
+		{"8/pp6/4k3/8/8/2K5/5PPP/4N3 w - - 0 1", "KNPPPvKPP", 0, false},
+		// the queen outranks the rooks when both sides have as many pieces
+		{"8/5p2/3qk3/8/8/2KR4/8/5R2 b - - 0 1", "KQPvKRR", 0, true},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		key, stm, ok := b.SyzygyKey()
+		if key != test.key || stm != test.stm || ok != test.ok {
+			t.Error("Wrong Syzygy key for", test.fen, "\nExpected", test.key, test.stm, test.ok, "but got", key, stm, ok)
+		}
+	}
+}
+
+func TestShortestPiecePath(t *testing.T) {
+	b := ParseFen("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	tests := []struct {
+		from, to  string
+		piece     Piece
+		moves     int
+		reachable bool
+	}{
+		{"a1", "a1", Knight, 0, true},
+		{"g1", "f3", Knight, 1, true},
+		{"a1", "b2", Knight, 4, true},
+		{"a1", "h8", Knight, 6, true},
+		{"c1", "h6", Bishop, 1, true},
+		{"c1", "h8", Bishop, 2, true},
+		{"c1", "d3", Bishop, 0, false},
+		{"a1", "a8", Rook, 1, true},
+		{"a1", "h8", Rook, 2, true},
+		{"b3", "e7", Rook, 2, true},
+		{"a1", "b3", Queen, 2, true},
+		{"a1", "h8", King, 7, true},
+		{"e2", "e4", Pawn, 1, true},
+		{"e2", "e8", Pawn, 5, true},
+		{"e2", "d3", Pawn, 0, false},
+		{"e4", "e3", Pawn, 0, false},
+	}
+	for _, v := range tests {
+		from := Square(algebraicToIndexFatal(v.from))
+		to := Square(algebraicToIndexFatal(v.to))
+		moves, reachable := b.ShortestPiecePath(from, to, v.piece)
+		if moves != v.moves || reachable != v.reachable {
+			t.Error("Wrong path length from", v.from, "to", v.to, "for piece", v.piece,
+				"\nExpected", v.moves, v.reachable, "but got", moves, reachable)
+		}
+	}
+	// Black pawns move down the board.
+	b = ParseFen("4k3/8/8/8/8/8/8/4K3 b - - 0 1")
+	if moves, ok := b.ShortestPiecePath(Square(algebraicToIndexFatal("d7")), Square(algebraicToIndexFatal("d1")), Pawn); moves != 5 || !ok {
+		t.Error("Wrong black pawn path length\nExpected 5 true but got", moves, ok)
+	}
+}
+
+func TestOpponentThreats(t *testing.T) {
+	// Without pins or checks, the threats are exactly the opponent's legal moves.
+	positions := []string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3",
+		"4k3/8/1n1p4/4N3/3P4/8/8/4K3 w - - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		threats := b.OpponentThreats()
+		flipped := b.WithSideToMoveFlipped()
+		expected := flipped.GenerateLegalMoves()
+		if len(threats) != len(expected) {
+			t.Error("Threats: wrong length. Expected", len(expected), "but got", len(threats), "for", fen)
+		}
+		if b.ToFen() != fen {
+			t.Error("Generating threats corrupted board state for", fen)
+		}
+	}
+	// The black knight on d7 is pinned, so its moves are threats but not legal moves.
+	b := ParseFen("3k4/3n4/8/8/8/8/8/3RK3 w - - 0 1")
+	threats := b.OpponentThreats()
+	flipped := b.WithSideToMoveFlipped()
+	legal := flipped.GenerateLegalMoves()
+	if len(threats) != len(legal)+6 {
+		t.Error("Threats should include pinned piece moves. Got", len(threats), "threats and",
+			len(legal), "legal moves")
+	}
+	for _, m := range legal {
+		found := false
+		for _, threat := range threats {
+			found = found || threat == m
+		}
+		if !found {
+			t.Error("Legal move", &m, "is missing from the threats.")
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	// a capture: the white bishop on g5 takes the black knight on f6
+	before := ParseFen("rnbqkb1r/pppppppp/5n2/6B1/3P4/8/PPP1PPPP/RN1QKBNR w KQkq - 0 1")
+	after := before
+	after.Apply(parseMove("g5f6"))
+	added, removed := before.Diff(&after)
+	if len(added) != 1 || added[Square(algebraicToIndexFatal("f6"))] != Bishop {
+		t.Error("Wrong added pieces for capture:", added)
+	}
+	if len(removed) != 2 || removed[Square(algebraicToIndexFatal("g5"))] != Bishop ||
+		removed[Square(algebraicToIndexFatal("f6"))] != Knight {
+		t.Error("Wrong removed pieces for capture:", removed)
+	}
+	// a manual edit: the white queen is removed, and a black rook is added on h4
+	edited := ParseFen("rnbqkb1r/pppppppp/5n2/6B1/3P3r/8/PPP1PPPP/RN2KBNR w KQkq - 0 1")
+	added, removed = before.Diff(&edited)
+	if len(added) != 1 || added[Square(algebraicToIndexFatal("h4"))] != Rook {
+		t.Error("Wrong added pieces for edit:", added)
+	}
+	if len(removed) != 1 || removed[Square(algebraicToIndexFatal("d1"))] != Queen {
+		t.Error("Wrong removed pieces for edit:", removed)
+	}
+	// a recapture by the same piece type shows up in both maps
+	rooks := ParseFen("4k3/8/8/8/8/8/8/r3K2R b - - 0 1")
+	rooks2 := ParseFen("4k3/8/8/8/8/8/8/4K2r w - - 0 1")
+	added, removed = rooks.Diff(&rooks2)
+	h1 := Square(algebraicToIndexFatal("h1"))
+	if added[h1] != Rook || removed[h1] != Rook || len(added) != 1 || len(removed) != 2 {
+		t.Error("Wrong diff for a change of color:", added, removed)
+	}
+	if added, removed := before.Diff(&before); len(added) != 0 || len(removed) != 0 {
+		t.Error("Identical boards should have an empty diff.")
+	}
+}
+
+func TestNextMoveStatus(t *testing.T) {
+	positions := map[string][2]bool{
+		// playable, not in check
+		Startpos: {true, false},
+		// playable, in check
+		"rnbqkbnr/ppppp1pp/8/5p1Q/4P3/8/PPPP1PPP/RNB1KBNR b KQkq - 1 2": {true, true},
+		// checkmate
+		"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3": {false, true},
+		// stalemate
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1": {false, false},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		hasMoves, inCheck := b.NextMoveStatus()
+		if hasMoves != v[0] || inCheck != v[1] {
+			t.Error("Wrong move status for", k, "\nExpected", v, "but got", hasMoves, inCheck)
+		}
+		if b.ToFen() != k {
+			t.Error("Checking the move status corrupted board state for", k)
+		}
+	}
+}
+
+func TestChecksGivenBy(t *testing.T) {
+	positions := []struct {
+		fen    string
+		move   string
+		checks int
+	}{
+		// quiet move
+		{Startpos, "e2e4", 0},
+		// direct check
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", "d1e2", 1},
+		// discovered check by the rook
+		{"4k3/8/8/8/4N3/8/8/4RK2 w - - 0 1", "e4c3", 1},
+		// direct knight check along with a discovered rook check
+		{"4k3/8/8/8/4N3/8/8/4RK2 w - - 0 1", "e4f6", 2},
+	}
+	for _, v := range positions {
+		b := ParseFen(v.fen)
+		if checks := b.ChecksGivenBy(parseMove(v.move)); checks != v.checks {
+			t.Error("Wrong number of checks given by", v.move, "for", v.fen, "\nExpected", v.checks, "but got", checks)
+		}
+		if b.ToFen() != v.fen {
+			t.Error("Counting checks corrupted board state for", v.fen)
+		}
+	}
+}
+
+func TestLegalMovesWithResultingFEN(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		results := b.LegalMovesWithResultingFEN()
+		if len(results) != len(b.GenerateLegalMoves()) {
+			t.Error("Wrong number of results for", fen, ":", len(results))
+		}
+		if b.ToFen() != fen {
+			t.Error("Listing resulting FENs corrupted board state for", fen)
+		}
+		for _, r := range results {
+			independent := ParseFen(fen)
+			independent.Apply(r.Move)
+			if r.FEN != independent.ToFen() {
+				t.Error("Wrong resulting FEN for", &r.Move, "in", fen, "\nExpected",
+					independent.ToFen(), "but got", r.FEN)
+			}
+		}
+	}
+}
+
+func TestOnlyKingMoves(t *testing.T) {
+	positions := map[string]bool{
+		// the lone black king against king and queen
+		"8/8/4k3/8/8/2KQ4/8/8 b - - 0 1": true,
+		// white has the queen too
+		"8/8/4k3/8/8/2KQ4/8/8 w - - 0 1": false,
+		// the pawns can still move
+		"8/pp6/4k3/8/8/2K5/6PP/8 w - - 0 1": false,
+		"8/pp6/4k3/8/8/2K5/6PP/8 b - - 0 1": false,
+		// the black pawn is blocked
+		"8/8/4k3/8/4p3/4K3/8/8 b - - 0 1": true,
+		Startpos:                          false,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if b.OnlyKingMoves() != v {
+			t.Error("Wrong result for only king moves in", k, "\nExpected", v)
+		}
+	}
+}
+
+func TestIsValidPosition(t *testing.T) {
+	valid := []string{
+		Startpos,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		// in check, with the side to move
+		"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3",
+	}
+	for _, fen := range valid {
+		b, _ := ParseFenSafe(fen)
+		if ok, err := b.IsValidPosition(); !ok || err != nil {
+			t.Error("Rejected a valid position", fen, ":", err)
+		}
+	}
+	invalid := []string{
+		// two white kings (ParseFen does not check this)
+		"4k3/8/8/8/8/8/8/K3K3 w - - 0 1",
+		// the side not to move is in check
+		"4k3/8/8/8/Q7/8/8/4K3 w - - 0 1",
+		"4k3/4R3/8/8/8/8/8/4K3 w - - 0 1",
+		// pawns on the first and last ranks
+		"4k3/8/8/8/8/8/8/P3K3 w - - 0 1",
+		"p3k3/8/8/8/8/8/8/4K3 w - - 0 1",
+		// castling rights without the rook or king at home
+		"r3k2r/8/8/8/8/8/8/R3K1R1 w KQkq - 0 1",
+		"r3k2r/8/8/8/8/8/8/R2K3R w KQ - 0 1",
+		"1r2k2r/8/8/8/8/8/8/R3K2R w KQq - 0 1",
+		// en passant squares without a double push
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e3 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/4N3/PPPP1PPP/RNBQKB1R b KQkq e3 0 1",
+	}
+	for _, fen := range invalid {
+		b := ParseFen(fen)
+		if ok, err := b.IsValidPosition(); ok || err == nil {
+			t.Error("Accepted an invalid position", fen)
+		}
+	}
+}
+
+func TestGenerateMovesForPieces(t *testing.T) {
+	b := ParseFen("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	fen := b.ToFen()
+	// only knights: Nf3 has 5 moves (d4, e5, g1, g5, h4) and Nb1 has 2
+	if moves := b.GenerateMovesForPieces(KnightMask); len(moves) != 7 {
+		t.Error("Knight moves: wrong length. Expected 7 but got", len(moves))
+	}
+	// only sliders: the bishop has 5 moves, the queen 1, and the h1 rook 1
+	sliders := b.GenerateMovesForPieces(SliderMask)
+	if len(sliders) != 7 {
+		t.Error("Slider moves: wrong length. Expected 7 but got", len(sliders))
+	}
+	for _, m := range sliders {
+		piece, _ := b.pieceAt(Square(m.From()))
+		if !SliderMask.Contains(piece) {
+			t.Error("Generated a move for a non-slider:", &m)
+		}
+	}
+	// all pieces, which matches the legal moves without pins, checks, or castling
+	all := b.GenerateMovesForPieces(AllPiecesMask)
+	legal := b.GenerateLegalMoves()
+	if len(all) != len(legal) {
+		t.Error("All piece moves: wrong length. Expected", len(legal), "but got", len(all))
+	}
+	for _, m := range legal {
+		found := false
+		for _, other := range all {
+			found = found || other == m
+		}
+		if !found {
+			t.Error("Legal move", &m, "is missing from the moves for all pieces.")
+		}
+	}
+	if moves := b.GenerateMovesForPieces(0); len(moves) != 0 {
+		t.Error("Generated moves for an empty mask.")
+	}
+	if b.ToFen() != fen {
+		t.Error("Generating moves for pieces corrupted board state.")
+	}
+}
+
+func TestStalematingMoves(t *testing.T) {
+	// only Qg6 takes away every square from the cornered king without giving check
+	fen := "7k/8/5K2/8/8/8/8/6Q1 w - - 0 1"
+	b := ParseFen(fen)
+	moves := b.StalematingMoves()
+	if b.ToFen() != fen {
+		t.Error("Finding stalemating moves corrupted board state.")
+	}
+	found := false
+	for _, m := range moves {
+		found = found || m == parseMove("g1g6")
+		after := ParseFen(fen)
+		after.Apply(m)
+		if !after.IsStalemate() {
+			t.Error("Move", &m, "does not stalemate the opponent.")
+		}
+	}
+	if !found {
+		t.Error("Failed to find the stalemating move g1g6.")
+	}
+	if len(moves) != 1 {
+		t.Error("Stalemating moves: wrong length. Expected 1 but got", len(moves))
+	}
+	// a checkmate is not a stalemate
+	mate := ParseFen("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	if moves := mate.StalematingMoves(); len(moves) != 0 {
+		t.Error("Found stalemating moves in a position with none:", len(moves))
+	}
+	start := ParseFen(Startpos)
+	if moves := start.StalematingMoves(); len(moves) != 0 {
+		t.Error("Found stalemating moves in the starting position.")
+	}
+}
+
+func TestReplyMobility(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"7k/8/5K2/8/8/8/8/6Q1 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		mobility := b.ReplyMobility()
+		if b.ToFen() != fen {
+			t.Error("Computing reply mobility corrupted board state.")
+		}
+		moves := b.GenerateLegalMoves()
+		if len(mobility) != len(moves) {
+			t.Error("Wrong number of moves in reply mobility for", fen, "\nExpected", len(moves), "but got", len(mobility))
+		}
+		for _, m := range moves {
+			after := ParseFen(fen)
+			after.Apply(m)
+			if expected := len(after.GenerateLegalMoves()); mobility[m] != expected {
+				t.Error("Wrong reply count for", &m, "in", fen, "\nExpected", expected, "but got", mobility[m])
+			}
+		}
+	}
+	// stalemating and mating moves leave no replies
+	b := ParseFen("7k/8/5K2/8/8/8/8/6Q1 w - - 0 1")
+	mobility := b.ReplyMobility()
+	if replies := mobility[parseMove("g1g6")]; replies != 0 {
+		t.Error("Wrong reply count for the stalemating move g1g6\nExpected 0 but got", replies)
+	}
+	if replies := mobility[parseMove("g1g7")]; replies != 0 {
+		t.Error("Wrong reply count for the mating move g1g7\nExpected 0 but got", replies)
+	}
+	if replies := mobility[parseMove("g1h1")]; replies != 1 {
+		t.Error("Wrong reply count for g1h1\nExpected 1 but got", replies)
+	}
+}
+
+func TestEffectiveCastlingRights(t *testing.T) {
+	positions := map[string]CastleRights{
+		Startpos: AllCastleRights,
+		// the white king has moved, but the flags are still set
+		"r3k2r/8/8/8/8/8/8/R4K1R w KQkq - 0 1": BlackKingside | BlackQueenside,
+		// the h8 and a1 rooks are gone
+		"r3k3/8/8/8/8/8/8/4K2R b KQkq - 0 1": WhiteKingside | BlackQueenside,
+		// both kings have moved
+		"r2k3r/8/8/8/8/8/8/R2K3R w KQkq - 0 1": 0,
+		// no flags to begin with
+		"r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1": 0,
+		// Chess960 rights with the king off the e-file
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": AllCastleRights,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if rights := b.EffectiveCastlingRights(); rights != v {
+			t.Error("Wrong effective castling rights for", k, "\nExpected", v, "but got", rights)
+		}
+		if b.ToFen() != k {
+			t.Error("Computing effective castling rights modified the board for", k)
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	positions := map[string]string{
+		Startpos: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1":        "rnbqkbnr/pppp1ppp/8/4p3/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w Kq - 3 7": "r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b Qk - 3 7",
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		mirrored := b.Mirror()
+		if mirrored.ToFen() != v {
+			t.Error("Wrong mirror of", k, "\nExpected", v, "but got", mirrored.ToFen())
+		}
+		if mirrored.Hash() != recomputeBoardHash(&mirrored) || mirrored.CurrentMaterial() != -b.CurrentMaterial() {
+			t.Error("Inconsistent hash or material in the mirror of", k)
+		}
+		if twice := mirrored.Mirror(); !twice.EqualPosition(&b) {
+			t.Error("Mirroring twice did not restore", k)
+		}
+		if len(mirrored.GenerateLegalMoves()) != len(b.GenerateLegalMoves()) {
+			t.Error("The mirror of", k, "has a different number of legal moves.")
+		}
+	}
+}
+
+func TestEqualPosition(t *testing.T) {
+	a := ParseFen("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1")
+	positions := map[string]bool{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1":  true,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 7 20": true,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e3 0 1":  false,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQk e3 0 1":   false,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1":   false,
+		"rnbqkbnr/pppppppp/8/8/8/4P3/PPPP1PPP/RNBQKBNR b KQkq - 0 1":   false,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if a.EqualPosition(&b) != v {
+			t.Error("Wrong position equality for", k, "\nExpected", v)
+		}
+	}
+}
+
+func TestIsSymmetric(t *testing.T) {
+	positions := map[string]bool{
+		Startpos: true,
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2":         true,
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3":     false,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1": false,
+		// symmetric pieces but asymmetric castling rights
+		"r3k2r/8/8/8/8/8/8/R3K2R w Kkq - 0 1": false,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if b.IsSymmetric() != v {
+			t.Error("Wrong symmetry for", k, "\nExpected", v)
+		}
+	}
+}
+
+func TestFilterMoves(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	captures := b.FilterLegalMoves(func(b *Board, m Move) bool {
+		return IsCapture(m, b)
+	})
+	if len(captures) != 8 {
+		t.Error("Capture filter: wrong length. Expected 8 but got", len(captures))
+	}
+	// of those, only the captures that do not lose material
+	good := b.FilterLegalMoves(func(b *Board, m Move) bool {
+		return IsCapture(m, b) && b.SEE(m) >= 0
+	})
+	for _, m := range captures {
+		kept := false
+		for _, g := range good {
+			kept = kept || g == m
+		}
+		if kept != (b.SEE(m) >= 0) {
+			t.Error("Capture", &m, "was wrongly kept or dropped by the SEE filter.")
+		}
+	}
+	if len(good) == 0 || len(good) == len(captures) {
+		t.Error("SEE filter should keep some, but not all, captures. Kept", len(good))
+	}
+	// Qxf6 loses the queen for a knight, so it is dropped
+	for _, m := range good {
+		if m == parseMove("f3f6") {
+			t.Error("SEE filter kept a losing queen capture.")
+		}
+	}
+	all := b.GenerateLegalMoves()
+	if none := FilterMoves(all, func(Move) bool { return false }); len(none) != 0 {
+		t.Error("Filtering out every move left", len(none), "moves.")
+	}
+	if every := FilterMoves(all, func(Move) bool { return true }); len(every) != len(all) {
+		t.Error("Filtering in every move dropped moves.")
+	}
+}
+
+func TestGenerateChecks(t *testing.T) {
+	positions := map[string]int{
+		// Qa4, Qd7, Qd8, Qe2 and Qh5
+		"4k3/8/8/8/8/8/8/3QK3 w - - 0 1": 5,
+		// every move of the e4 knight uncovers the rook
+		"4k3/8/8/8/4N3/8/8/4RK2 w - - 0 1": 8,
+		// no checking moves
+		"8/8/4k3/8/8/2K5/8/8 w - - 0 1": 0,
+		Startpos:                        0,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		checks := b.GenerateChecks()
+		if len(checks) != v {
+			t.Error("Checks: wrong length. Expected", v, "but got", len(checks), "for", k)
+		}
+		for _, m := range checks {
+			if b.ChecksGivenBy(m) == 0 {
+				t.Error("Move", &m, "does not give check in", k)
+			}
+		}
+		if b.HasCheckGivingMove() != (v > 0) {
+			t.Error("Wrong result for whether a checking move exists in", k)
+		}
+		if b.ToFen() != k {
+			t.Error("Generating checks corrupted board state for", k)
+		}
+	}
+}
+
+func TestIsKnownFortress(t *testing.T) {
+	positions := map[string]bool{
+		// the dark-squared bishop cannot drive the king out of the a8 corner
+		"k7/8/P7/8/8/4B3/8/4K3 w - - 0 1":   true,
+		"k7/8/P7/8/4B3/8/8/4K3 w - - 0 1":   false,
+		"8/8/P7/8/8/4B3/8/4K2k w - - 0 1":   false,
+		"k7/8/P7/8/8/4B3/7P/4K3 w - - 0 1":  false,
+		"kn6/8/P7/8/8/4B3/8/4K3 w - - 0 1":  false,
+		"1k6/8/P7/P7/8/8/8/4K3 b - - 0 1":   true,
+		"4k3/8/8/2b5/7p/7p/8/6K1 w - - 0 1": true,
+		"4k3/8/2b5/8/7p/7p/8/6K1 w - - 0 1": false,
+		"4k3/8/8/8/8/8/8/K6Q w - - 0 1":     false,
+		Startpos:                            false,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if res := b.IsKnownFortress(); res != v {
+			t.Error("Wrong fortress result for", k, "\nExpected", v, "but got", res)
+		}
+	}
+}
+
+func TestMoveLeadsToInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected bool
+	}{
+		{"8/8/4k3/8/4p3/3K4/8/8 w - - 0 1", "d3e4", true},
+		{"8/8/4k3/8/4p3/3K4/8/8 w - - 0 1", "d3c3", false},
+		{"8/8/4k3/8/4p3/3K4/8/6N1 w - - 0 1", "d3e4", true},
+		{"8/8/4k3/8/4p3/3K4/8/7R w - - 0 1", "d3e4", false},
+		{"8/8/4k3/8/4p3/3K4/8/6N1 b - - 0 1", "e6d5", false},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if result := b.MoveLeadsToInsufficientMaterial(parseMove(test.move)); result != test.expected {
+			t.Error("Wrong insufficient material result for", test.move, "in", test.fen, "\nExpected", test.expected)
+		}
+		if b.ToFen() != test.fen {
+			t.Error("Checking a move for insufficient material modified the board.")
+		}
+	}
+}
+
+func TestClassifyMoves(t *testing.T) {
+	b := ParseFen("r3k2r/1P6/8/3Pp3/8/8/8/R3K2R w KQkq e6 0 1")
+	expected := map[string]MoveInfo{
+		"a1a2":  {},
+		"d5d6":  {},
+		"d5e6":  {Capture: true, EnPassant: true},
+		"b7b8n": {Promotion: Knight},
+		"b7b8q": {Promotion: Queen, Check: true},
+		"b7a8r": {Capture: true, Promotion: Rook, Check: true},
+		"e1g1":  {Castle: WhiteKingside},
+		"e1c1":  {Castle: WhiteQueenside},
+		"h1h8":  {Capture: true, Check: true},
+		"a1a8":  {Capture: true, Check: true},
+	}
+	var moves []Move
+	for uci := range expected {
+		moves = append(moves, parseMove(uci))
+	}
+	for _, info := range b.ClassifyMoves(moves) {
+		want := expected[info.Move.String()]
+		want.Move = info.Move
+		if info != want {
+			t.Error("Wrong classification for", &info.Move, "\nExpected", want, "but got", info)
+		}
+	}
+	black := ParseFen("r3k2r/8/8/8/8/8/8/4K3 b kq - 0 1")
+	infos := black.ClassifyMoves([]Move{parseMove("e8g8"), parseMove("e8c8")})
+	if infos[0].Castle != BlackKingside || infos[1].Castle != BlackQueenside {
+		t.Error("Wrong castling classification for black:", infos)
+	}
+}
+
+func TestIsQuiet(t *testing.T) {
+	positions := map[string]bool{
+		Startpos: true,
+		// a maneuvering position with the pawns locked
+		"r1bq1rk1/pp1nbppp/2p1p3/3pP3/3P4/5N2/PPP1BPPP/RNBQR1K1 w - - 0 10": true,
+		// many captures are available
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1": false,
+		// only an en passant capture
+		"4k3/8/8/3Pp3/8/8/8/4K3 w - e6 0 1": false,
+		// only a promotion
+		"4k3/P7/8/8/8/8/8/4K3 w - - 0 1": false,
+		// in check, with no captures
+		"4k3/8/8/8/8/8/8/r3K3 w - - 0 1": false,
+	}
+	for fen, expected := range positions {
+		b := ParseFen(fen)
+		if quiet := b.IsQuiet(); quiet != expected {
+			t.Error("Wrong quiet status for", fen, "\nExpected", expected)
+		}
+	}
+}
+
+func TestIsPromotingMove(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected bool
+	}{
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8q", true},
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8n", true},
+		// a GUI move without a promotion piece yet
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8", true},
+		{"4k3/8/8/8/8/8/1p6/R3K3 b - - 0 1", "b2a1q", true},
+		{"4k3/8/8/8/8/8/1p6/R3K3 b - - 0 1", "b2b1r", true},
+		{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "e1e2", false},
+		{Startpos, "e2e4", false},
+		// a king reaching the last rank is not a promotion
+		{"8/4K3/8/8/8/8/8/k7 w - - 0 1", "e7e8", false},
+		// it is black's pawn, but white's turn
+		{"4k3/8/8/8/8/8/1p6/R3K3 w - - 0 1", "b2b1q", false},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if result := b.IsPromotingMove(parseMove(test.move)); result != test.expected {
+			t.Error("Wrong promotion status for", test.move, "in", test.fen, "\nExpected", test.expected)
+		}
+	}
+}
+
+func TestIsRecapture(t *testing.T) {
+	// white has just played exd5
+	b := ParseFen("4k3/3q4/8/3P4/1p6/P7/8/4K3 b - - 0 1")
+	lastMove := parseMove("e4d5")
+	tests := map[string]bool{
+		"d7d5": true,
+		"b4a3": false,
+		"d7d6": false,
+		"b4b3": false,
+	}
+	for k, v := range tests {
+		if res := b.IsRecapture(parseMove(k), lastMove); res != v {
+			t.Error("Wrong recapture result for", k, "\nExpected", v, "but got", res)
+		}
+	}
+	if b.IsRecapture(parseMove("d7d5"), NullMove) {
+		t.Error("A capture after a null move was reported as a recapture.")
+	}
+}
+
+func TestPinnedPieceLegalMoves(t *testing.T) {
+	tests := []struct {
+		fen      string
+		square   string
+		expected uint64
+	}{
+		// the rook slides along the file, up to and including the pinning rook
+		{"4k3/4r3/8/8/8/8/4R3/4K3 w - - 0 1", "e2", bitboardOf("e3", "e4", "e5", "e6", "e7")},
+		{"4k3/8/8/8/q7/8/2B5/3K4 w - - 0 1", "c2", bitboardOf("b3", "a4")},
+		// a pinned knight can never move
+		{"4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", "e2", 0},
+		// a piece that is not pinned
+		{"4k3/4r3/8/8/8/8/3N4/4K3 w - - 0 1", "d2", 0},
+		{"4k3/4n3/8/8/8/8/8/R3K3 b - - 0 1", "e7", 0},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if moves := b.PinnedPieceLegalMoves(Square(algebraicToIndexFatal(test.square))); moves != test.expected {
+			t.Error("Wrong pinned piece moves for", test.square, "in", test.fen, "\nExpected", test.expected, "but got", moves)
+		}
+	}
+}
@@ -6,29 +6,33 @@ package dragontoothmg
 func (b *Board) Apply(m Move) func() {
 	// Configure data about which pieces move
 	var ourBitboardPtr, oppBitboardPtr *Bitboards
-	var epDelta int8                                // add this to the e.p. square to find the captured pawn
-	var oppStartingRankBb, ourStartingRankBb uint64 // the starting rank of out opponent's major pieces
+	var epDelta int8 // add this to the e.p. square to find the captured pawn
+	var ourKingside, ourQueenside, oppKingside, oppQueenside CastleRights
 	// the constant that represents the index into pieceSquareZobristC for the pawn of our color
 	var ourPiecesPawnZobristIndex int
 	var oppPiecesPawnZobristIndex int
+	var materialSign int16 = 1 // material changes are positive for white
 	if b.Wtomove {
 		ourBitboardPtr = &(b.White)
 		oppBitboardPtr = &(b.Black)
 		epDelta = -8
-		oppStartingRankBb = onlyRank[7]
-		ourStartingRankBb = onlyRank[0]
+		ourKingside, ourQueenside = WhiteKingside, WhiteQueenside
+		oppKingside, oppQueenside = BlackKingside, BlackQueenside
 		ourPiecesPawnZobristIndex = 0
 		oppPiecesPawnZobristIndex = 6
 	} else {
 		ourBitboardPtr = &(b.Black)
 		oppBitboardPtr = &(b.White)
 		epDelta = 8
-		oppStartingRankBb = onlyRank[0]
-		ourStartingRankBb = onlyRank[7]
+		ourKingside, ourQueenside = BlackKingside, BlackQueenside
+		oppKingside, oppQueenside = WhiteKingside, WhiteQueenside
 		b.Fullmoveno++ // increment after black's move
+		materialSign = -1
 		ourPiecesPawnZobristIndex = 6
 		oppPiecesPawnZobristIndex = 0
 	}
+	oldMaterial := b.material
+	oldCastleFiles := b.castleFiles
 	fromBitboard := (uint64(1) << m.From())
 	toBitboard := (uint64(1) << m.To())
 	pieceType, pieceTypeBitboard := determinePieceType(ourBitboardPtr, fromBitboard)
@@ -70,12 +74,10 @@ func (b *Board) Apply(m Move) func() {
 
 	// Rook moves strip castling rights
 	if pieceType == Rook {
-		if b.canCastleKingside() && (fromBitboard&onlyFile[7] != 0) &&
-			fromBitboard&ourStartingRankBb != 0 { // king's rook
+		if b.canCastleKingside() && m.From() == b.castlingRookSquare(ourKingside) { // king's rook
 			flippedKsCastle = true
 			b.flipKingsideCastle()
-		} else if b.canCastleQueenside() && (fromBitboard&onlyFile[0] != 0) &&
-			fromBitboard&ourStartingRankBb != 0 { // queen's rook
+		} else if b.canCastleQueenside() && m.From() == b.castlingRookSquare(ourQueenside) { // queen's rook
 			flippedQsCastle = true
 			b.flipQueensideCastle()
 		}
@@ -103,6 +105,7 @@ func (b *Board) Apply(m Move) func() {
 		oppBitboardPtr.All &= ^(uint64(1) << epOpponentPawnLocation)
 		// Remove the opponent pawn from the board hash.
 		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex][epOpponentPawnLocation]
+		b.material += materialSign * pieceValues[Pawn]
 	}
 	// Update the en passant square
 	if pieceType == Pawn && (int8(m.To())+2*epDelta == int8(m.From())) { // pawn double push
@@ -142,20 +145,23 @@ func (b *Board) Apply(m Move) func() {
 		*capturedBitboard &= ^toBitboard
 		oppBitboardPtr.All &= ^toBitboard
 		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(capturedPieceType)-1)][m.To()] // remove the captured piece from the hash
+		b.material += materialSign * pieceValues[capturedPieceType]
 	}
+	b.material += materialSign * (pieceValues[promotedToPieceType] - pieceValues[pieceType])
 	b.hash ^= pieceSquareZobristC[(int(pieceType)-1)+ourPiecesPawnZobristIndex][m.From()]         // remove piece at "from"
 	b.hash ^= pieceSquareZobristC[(int(promotedToPieceType)-1)+ourPiecesPawnZobristIndex][m.To()] // add piece at "to"
 
 	// If a rook was captured, it strips castling rights
 	if capturedPieceType == Rook {
-		if m.To()%8 == 7 && toBitboard&oppStartingRankBb != 0 && b.oppCanCastleKingside() { // captured king rook
+		if m.To() == b.castlingRookSquare(oppKingside) && b.oppCanCastleKingside() { // captured king rook
 			b.flipOppKingsideCastle()
 			flippedOppKsCastle = true
-		} else if m.To()%8 == 0 && toBitboard&oppStartingRankBb != 0 && b.oppCanCastleQueenside() { // queen rooks
+		} else if m.To() == b.castlingRookSquare(oppQueenside) && b.oppCanCastleQueenside() { // queen rooks
 			b.flipOppQueensideCastle()
 			flippedOppQsCastle = true
 		}
 	}
+	b.clearLostCastleFiles()
 	// flip the side to move in the hash
 	b.hash ^= whiteToMoveZobristC
 	b.Wtomove = !b.Wtomove
@@ -164,8 +170,20 @@ func (b *Board) Apply(m Move) func() {
 	b.hash ^= uint64(oldEpCaptureSquare)
 	b.hash ^= uint64(b.enpassant)
 
+	// record the new position for repetition detection
+	var oldIrreversible int
+	if b.repetitions != nil {
+		irreversible := resetHalfmoveClockFrom != -1 || flippedKsCastle || flippedQsCastle ||
+			flippedOppKsCastle || flippedOppQsCastle
+		oldIrreversible = b.repetitions.push(b.hash, irreversible)
+	}
+
 	// Return the unapply function (closure)
 	unapply := func() {
+		if b.repetitions != nil {
+			b.repetitions.pop(oldIrreversible)
+		}
+
 		// Flip the player to move
 		b.hash ^= whiteToMoveZobristC
 		b.Wtomove = !b.Wtomove
@@ -216,6 +234,9 @@ func (b *Board) Apply(m Move) func() {
 			b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex][epOpponentPawnLocation]
 		}
 
+		// Restore the material balance
+		b.material = oldMaterial
+
 		// Decrement move clock
 		if !b.Wtomove {
 			b.Fullmoveno-- // decrement after undoing black's move
@@ -235,10 +256,194 @@ func (b *Board) Apply(m Move) func() {
 		if flippedOppQsCastle {
 			b.flipOppQueensideCastle()
 		}
+		b.castleFiles = oldCastleFiles
 	}
 	return unapply
 }
 
+// Applies a null move, passing the turn to the opponent without moving a piece.
+// The en passant square is cleared, and the move clocks advance as for a quiet move.
+// Returns a function that can be used to unapply it. The side to move must not be in check.
+func (b *Board) ApplyNullMove() func() {
+	oldEpCaptureSquare := b.enpassant
+	b.hash ^= uint64(oldEpCaptureSquare)
+	b.enpassant = 0
+	b.Halfmoveclock++
+	if !b.Wtomove {
+		b.Fullmoveno++ // increment after black's move
+	}
+	b.hash ^= whiteToMoveZobristC
+	b.Wtomove = !b.Wtomove
+	// positions before a null move are not repetitions of positions after it
+	var oldIrreversible int
+	if b.repetitions != nil {
+		oldIrreversible = b.repetitions.push(b.hash, true)
+	}
+
+	unapply := func() {
+		if b.repetitions != nil {
+			b.repetitions.pop(oldIrreversible)
+		}
+		b.hash ^= whiteToMoveZobristC
+		b.Wtomove = !b.Wtomove
+		if !b.Wtomove {
+			b.Fullmoveno-- // decrement after undoing black's move
+		}
+		b.Halfmoveclock--
+		b.enpassant = oldEpCaptureSquare
+		b.hash ^= uint64(oldEpCaptureSquare)
+	}
+	return unapply
+}
+
+// The state that a move destroys, recorded by ApplyWithUndo() so that Unapply()
+// can restore the board without keeping the unapply closure. It holds only plain
+// values, so it can be stored or serialized along with the move.
+type Undo struct {
+	Captured      Piece        // the piece captured by the move, Pawn for en passant
+	EnPassant     uint8        // the en passant square before the move
+	CastleRights  CastleRights // the castling rights before the move
+	Halfmoveclock uint8
+	Hash          uint64
+	Material      int16
+	irreversible  int      // repetition buffer state, if tracking is enabled
+	castleFiles   [4]uint8 // the castling rook files before the move
+}
+
+// Like Apply(), but also returns an Undo record for the move. Either the returned
+// closure or Unapply() with the record may be used to take the move back.
+func (b *Board) ApplyWithUndo(m Move) (func(), Undo) {
+	ourPieces, oppPieces := &(b.White), &(b.Black)
+	if !b.Wtomove {
+		ourPieces, oppPieces = &(b.Black), &(b.White)
+	}
+	undo := Undo{
+		EnPassant:     b.enpassant,
+		CastleRights:  b.CastlingRights(),
+		Halfmoveclock: b.Halfmoveclock,
+		Hash:          b.hash,
+		Material:      b.material,
+		castleFiles:   b.castleFiles,
+	}
+	undo.Captured, _ = determinePieceType(oppPieces, uint64(1)<<m.To())
+	pieceType, _ := determinePieceType(ourPieces, uint64(1)<<m.From())
+	if pieceType == Pawn && m.To() == b.enpassant && b.enpassant != 0 {
+		undo.Captured = Pawn // en passant
+	}
+	if b.repetitions != nil {
+		undo.irreversible = b.repetitions.irreversible
+	}
+	return b.Apply(m), undo
+}
+
+// Takes back the move, which must be the last move applied to the board, using the
+// Undo record that ApplyWithUndo() returned for it. The board is restored exactly.
+func (b *Board) Unapply(m Move, undo Undo) {
+	if b.repetitions != nil {
+		b.repetitions.pop(undo.irreversible)
+	}
+	b.Wtomove = !b.Wtomove
+	ourPieces, oppPieces := &(b.White), &(b.Black)
+	var epDelta int8 = -8 // add this to the e.p. square to find the captured pawn
+	if !b.Wtomove {
+		ourPieces, oppPieces = &(b.Black), &(b.White)
+		epDelta = 8
+		b.Fullmoveno-- // decrement after undoing black's move
+	}
+	fromBitboard := uint64(1) << m.From()
+	toBitboard := uint64(1) << m.To()
+
+	// Move the piece back, demoting it if it was promoted
+	pieceType, pieceTypeBitboard := determinePieceType(ourPieces, toBitboard)
+	*pieceTypeBitboard &= ^toBitboard
+	if m.Promote() != Nothing {
+		pieceType = Pawn
+		pieceTypeBitboard = &(ourPieces.Pawns)
+	}
+	*pieceTypeBitboard |= fromBitboard
+	ourPieces.All = (ourPieces.All &^ toBitboard) | fromBitboard
+
+	// Move the rook back after castling
+	if pieceType == King && (m.To()-m.From() == 2 || int(m.To())-int(m.From()) == -2) {
+		oldRookLoc, newRookLoc := m.To()+1, m.To()-1
+		if m.To() < m.From() {
+			oldRookLoc, newRookLoc = m.To()-2, m.To()+1
+		}
+		rookMove := (uint64(1) << oldRookLoc) | (uint64(1) << newRookLoc)
+		ourPieces.Rooks ^= rookMove
+		ourPieces.All ^= rookMove
+	}
+
+	// Restore the captured piece
+	if undo.Captured != Nothing {
+		capturedSquare := toBitboard
+		if pieceType == Pawn && m.To() == undo.EnPassant && undo.EnPassant != 0 {
+			capturedSquare = uint64(1) << uint8(int8(undo.EnPassant)+epDelta)
+		}
+		*pieceBitboard(oppPieces, undo.Captured) |= capturedSquare
+		oppPieces.All |= capturedSquare
+	}
+
+	b.enpassant = undo.EnPassant
+	b.castlerights = uint8(undo.CastleRights)
+	b.castleFiles = undo.castleFiles
+	b.Halfmoveclock = undo.Halfmoveclock
+	b.hash = undo.Hash
+	b.material = undo.Material
+}
+
+// Returns the castling rights that would remain after the move, without applying
+// it: a king move loses both of the mover's rights, a move from a castling rook's
+// home square loses that rook's right, and capturing a rook on its home square
+// loses the opponent's right for that rook. The home square is the corner, or the
+// rook file given in a Chess960 FEN. These are the rights Apply() would leave.
+func (b *Board) CastlingRightsAfter(m Move) CastleRights {
+	rights := b.CastlingRights()
+	ourKingside, ourQueenside := WhiteKingside, WhiteQueenside
+	oppKingside, oppQueenside := BlackKingside, BlackQueenside
+	ourPieces, oppPieces := &(b.White), &(b.Black)
+	if !b.Wtomove {
+		ourKingside, ourQueenside, oppKingside, oppQueenside = oppKingside, oppQueenside, ourKingside, ourQueenside
+		ourPieces, oppPieces = &(b.Black), &(b.White)
+	}
+	pieceType, _ := determinePieceType(ourPieces, uint64(1)<<m.From())
+	if pieceType == King {
+		rights &= ^(ourKingside | ourQueenside)
+	}
+	if pieceType == Rook {
+		switch m.From() {
+		case b.castlingRookSquare(ourKingside):
+			rights &= ^ourKingside
+		case b.castlingRookSquare(ourQueenside):
+			rights &= ^ourQueenside
+		}
+	}
+	if oppPieces.Rooks&(uint64(1)<<m.To()) != 0 {
+		switch m.To() {
+		case b.castlingRookSquare(oppKingside):
+			rights &= ^oppKingside
+		case b.castlingRookSquare(oppQueenside):
+			rights &= ^oppQueenside
+		}
+	}
+	return rights
+}
+
+// Whether the move is reversible: not a pawn move, a capture, or a move that
+// loses castling rights (which includes castling itself). Positions from before
+// an irreversible move can never repeat, and the fifty-move clock is reset by
+// pawn moves and captures.
+func (b *Board) IsReversibleMove(m Move) bool {
+	ourPieces := &(b.White)
+	if !b.Wtomove {
+		ourPieces = &(b.Black)
+	}
+	if pieceType, _ := determinePieceType(ourPieces, uint64(1)<<m.From()); pieceType == Pawn {
+		return false
+	}
+	return !IsCapture(m, b) && b.CastlingRightsAfter(m) == b.CastlingRights()
+}
+
 func determinePieceType(ourBitboardPtr *Bitboards, squareMask uint64) (Piece, *uint64) {
 	var pieceType Piece = Nothing
 	pieceTypeBitboard := &(ourBitboardPtr.All)
@@ -263,3 +468,20 @@ func determinePieceType(ourBitboardPtr *Bitboards, squareMask uint64) (Piece, *u
 	}
 	return pieceType, pieceTypeBitboard
 }
+
+// Returns a pointer to the bitboard for the given piece type, which must not be Nothing.
+func pieceBitboard(bb *Bitboards, p Piece) *uint64 {
+	switch p {
+	case Pawn:
+		return &(bb.Pawns)
+	case Knight:
+		return &(bb.Knights)
+	case Bishop:
+		return &(bb.Bishops)
+	case Rook:
+		return &(bb.Rooks)
+	case Queen:
+		return &(bb.Queens)
+	}
+	return &(bb.Kings)
+}
@@ -1,6 +1,7 @@
 package dragontoothmg
 
 import (
+	"math/rand"
 	"testing"
 )
 
@@ -138,3 +139,184 @@ func TestApplyUnapply(t *testing.T) {
 		}*/
 	}
 }
+
+// Plays out pseudo-random games, verifying the incrementally tracked material at every step.
+func TestIncrementalMaterial(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"r3k3/1ppp1ppr/8/3Pp3/8/8/1PP1PPPP/R3K2R w - e6 3 0",
+	}
+	r := rand.New(rand.NewSource(2))
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		var unapplies []func()
+		for ply := 0; ply < 60; ply++ {
+			moves := b.GenerateLegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			// prefer captures and promotions, to exercise the material updates
+			move := moves[r.Intn(len(moves))]
+			for _, m := range moves {
+				if (IsCapture(m, &b) || m.Promote() != Nothing) && r.Intn(2) == 0 {
+					move = m
+					break
+				}
+			}
+			unapplies = append(unapplies, b.Apply(move))
+			if b.CurrentMaterial() != b.Material() {
+				t.Error("Incremental material", b.CurrentMaterial(), "does not match", b.Material(),
+					"after move", &move, "in position", b.ToFen())
+			}
+		}
+		for i := len(unapplies) - 1; i >= 0; i-- {
+			unapplies[i]()
+			if b.CurrentMaterial() != b.Material() {
+				t.Error("Incremental material was not restored by unapply in position", b.ToFen())
+			}
+		}
+		if original := ParseFen(fen); b.ToFen() != original.ToFen() {
+			t.Error("Board was not restored after unapplying all moves.")
+		}
+	}
+}
+
+func TestMaterial(t *testing.T) {
+	positions := map[string]int{
+		Startpos:                         0,
+		"4k3/8/8/8/8/8/8/3QK3 w - - 0 1": 900,
+		"r3k3/1pp3P1/4N3/3b4/8/2p5/1P2PP1P/R3K2R w - - 0 0": 700,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if b.Material() != v || b.CurrentMaterial() != v {
+			t.Error("Wrong material for", k, "\nExpected", v, "but got", b.Material(), b.CurrentMaterial())
+		}
+	}
+}
+
+func TestApplyNullMove(t *testing.T) {
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	b := ParseFen(fen)
+	oldHash := b.Hash()
+	unapply := b.ApplyNullMove()
+	if b.ToFen() != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 1 2" {
+		t.Error("Wrong position after null move:", b.ToFen())
+	}
+	if b.Hash() != recomputeBoardHash(&b) {
+		t.Error("Null move produced an inconsistent hash.")
+	}
+	unapply()
+	if b.ToFen() != fen || b.Hash() != oldHash {
+		t.Error("Null move unapply did not restore the board:", b.ToFen())
+	}
+}
+
+func TestCastlingRightsAfter(t *testing.T) {
+	fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	black := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1"
+	corner := "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"
+	positions := []struct {
+		fen    string
+		move   string
+		rights CastleRights
+	}{
+		// king moves, including castling
+		{fen, "e1f1", BlackKingside | BlackQueenside},
+		{fen, "e1g1", BlackKingside | BlackQueenside},
+		{black, "e8c8", WhiteKingside | WhiteQueenside},
+		// each rook moving from its corner
+		{fen, "h1g1", WhiteQueenside | BlackKingside | BlackQueenside},
+		{fen, "a1b1", WhiteKingside | BlackKingside | BlackQueenside},
+		{black, "h8g8", AllCastleRights &^ BlackKingside},
+		{black, "a8b8", AllCastleRights &^ BlackQueenside},
+		// rook captures on the corners, removing both sides' rights
+		{corner, "a1a8", WhiteKingside | BlackKingside},
+		{corner, "h1h8", WhiteQueenside | BlackQueenside},
+		// other moves leave the rights alone
+		{fen, "e2a6", AllCastleRights},
+	}
+	for _, v := range positions {
+		b := ParseFen(v.fen)
+		rights := b.CastlingRightsAfter(parseMove(v.move))
+		if rights != v.rights {
+			t.Error("Wrong castling rights after", v.move, "in", v.fen, "\nExpected", v.rights, "but got", rights)
+		}
+		if b.ToFen() != v.fen {
+			t.Error("Computing castling rights corrupted board state for", v.fen)
+		}
+		b.Apply(parseMove(v.move))
+		if b.CastlingRights() != rights {
+			t.Error("Castling rights after", v.move, "disagree with Apply() in", v.fen)
+		}
+	}
+}
+
+func TestIsReversibleMove(t *testing.T) {
+	kiwipete := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	positions := []struct {
+		fen        string
+		move       string
+		reversible bool
+	}{
+		{Startpos, "g1f3", true},
+		{kiwipete, "e2d1", true},
+		// pawn moves, including a double push
+		{Startpos, "e2e4", false},
+		{kiwipete, "a2a3", false},
+		// captures
+		{kiwipete, "e5f7", false},
+		{kiwipete, "d5e6", false},
+		// castling
+		{kiwipete, "e1g1", false},
+		// losing castling rights
+		{kiwipete, "e1f1", false},
+		{kiwipete, "h1g1", false},
+		// a rook move after castling rights are gone
+		{"r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", "h1g1", true},
+	}
+	for _, v := range positions {
+		b := ParseFen(v.fen)
+		if b.IsReversibleMove(parseMove(v.move)) != v.reversible {
+			t.Error("Wrong reversibility for", v.move, "in", v.fen, "\nExpected", v.reversible)
+		}
+	}
+}
+
+func TestUnapply(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1",
+		"r3k3/1ppp1ppr/8/3Pp3/8/8/1PP1PPPP/R3K2R w - e6 3 5",
+		"r3k3/1ppp1ppr/8/8/2Pp4/8/1P2PPPP/R3K2R b - c3 0 5",
+		"r3k1Q1/1pp5/4N3/3br3/8/2p3n1/1p2PP2/R1B1K2n b - - 0 9",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		b.EnableRepetitionTracking()
+		original := b
+		for _, m := range b.GenerateLegalMoves() {
+			_, undo := b.ApplyWithUndo(m)
+			b.Unapply(m, undo)
+			if b != original || *b.repetitions != *original.repetitions {
+				t.Error("Unapply did not restore the board after", &m, "in", fen, "\nGot", b.ToFen())
+				b = ParseFen(fen)
+				b.EnableRepetitionTracking()
+				original = b
+			}
+		}
+	}
+	// the record, unlike the closure, can outlive a copy of the board
+	b := ParseFen(Startpos)
+	m := parseMove("e2e4")
+	_, undo := b.ApplyWithUndo(m)
+	copied := b
+	copied.Unapply(m, undo)
+	if copied.ToFen() != Startpos || copied.Hash() != recomputeBoardHash(&copied) {
+		t.Error("Unapply on a copy did not restore the starting position.")
+	}
+}
@@ -0,0 +1,507 @@
+package dragontoothmg
+
+// Attack queries for evaluation and analysis. Unlike countAttacks(), these return
+// the actual attacking pieces, and do not modify the board.
+
+import (
+	"math/bits"
+)
+
+// Returns a bitboard of all pieces of the given color that attack the square.
+// The piece on the square itself (if any) is not counted. Pins are not considered.
+func (b *Board) AttackersTo(s Square, byWhite bool) uint64 {
+	return b.attackersTo(s, byWhite, b.White.All|b.Black.All)
+}
+
+// Splits AttackersTo() by piece type: for each type of the given color's pieces
+// that attacks the square, the squares those attackers stand on. Types that do
+// not attack the square are left out of the map.
+func (b *Board) AttackBreakdown(s Square, byWhite bool) map[Piece]uint64 {
+	pieces := &(b.White)
+	if !byWhite {
+		pieces = &(b.Black)
+	}
+	attackers := b.AttackersTo(s, byWhite)
+	byType := [7]uint64{Pawn: pieces.Pawns, Knight: pieces.Knights, Bishop: pieces.Bishops,
+		Rook: pieces.Rooks, Queen: pieces.Queens, King: pieces.Kings}
+	breakdown := make(map[Piece]uint64)
+	for p := Piece(Pawn); p <= King; p++ {
+		if origins := attackers & byType[p]; origins != 0 {
+			breakdown[p] = origins
+		}
+	}
+	return breakdown
+}
+
+// Whether the square is attacked by the given color, using the supplied occupancy
+// in place of the board's actual occupancy. Sliders are blocked only by occupied
+// squares, and pieces on squares missing from the occupancy do not attack. This
+// answers questions like "would this square still be attacked if a piece moved away".
+func (b *Board) IsSquareAttackedWith(s Square, byWhite bool, occupied uint64) bool {
+	return b.attackersTo(s, byWhite, occupied) != 0
+}
+
+// Computes the attackers to a square, using the supplied occupancy to block sliders.
+func (b *Board) attackersTo(s Square, byWhite bool, occupied uint64) uint64 {
+	var pieces *Bitboards
+	var pawnAttackers uint64
+	squareMask := uint64(1) << s
+	if byWhite {
+		pieces = &(b.White)
+		pawnAttackers = ((squareMask >> 9) & ^onlyFile[7]) | ((squareMask >> 7) & ^onlyFile[0])
+	} else {
+		pieces = &(b.Black)
+		pawnAttackers = ((squareMask << 7) & ^onlyFile[7]) | ((squareMask << 9) & ^onlyFile[0])
+	}
+	attackers := pawnAttackers & pieces.Pawns
+	attackers |= knightMasks[s] & pieces.Knights
+	attackers |= kingMasks[s] & pieces.Kings
+	attackers |= CalculateBishopMoveBitboard(uint8(s), occupied) & (pieces.Bishops | pieces.Queens)
+	attackers |= CalculateRookMoveBitboard(uint8(s), occupied) & (pieces.Rooks | pieces.Queens)
+	return attackers & occupied
+}
+
+// Returns the pieces of the given color that are attacked by the enemy, and not
+// defended by any friendly piece. The king is never considered to be hanging,
+// since it cannot be captured.
+func (b *Board) HangingPieces(white bool) uint64 {
+	var ourPieces *Bitboards
+	if white {
+		ourPieces = &(b.White)
+	} else {
+		ourPieces = &(b.Black)
+	}
+	var hanging uint64
+	candidates := ourPieces.All & ^ourPieces.Kings
+	for candidates != 0 {
+		s := Square(bits.TrailingZeros64(candidates))
+		candidates &= candidates - 1
+		if b.AttackersTo(s, !white) != 0 && b.AttackersTo(s, white) == 0 {
+			hanging |= uint64(1) << s
+		}
+	}
+	return hanging
+}
+
+// Returns the pieces of the given color that stand between a friendly slider and
+// an enemy piece, so that moving them away would unmask an attack on that piece
+// (a discovered attack, or a discovered check if the enemy piece is the king).
+// Only the first piece along each of the slider's rays is considered.
+func (b *Board) DiscoveredAttackCandidates(white bool) uint64 {
+	ourPieces, enemyPieces := &(b.White), &(b.Black)
+	if !white {
+		ourPieces, enemyPieces = &(b.Black), &(b.White)
+	}
+	occupied := b.White.All | b.Black.All
+	var candidates uint64
+	sliders := []struct {
+		pieces uint64
+		moves  func(uint8, uint64) uint64
+	}{
+		{ourPieces.Bishops | ourPieces.Queens, CalculateBishopMoveBitboard},
+		{ourPieces.Rooks | ourPieces.Queens, CalculateRookMoveBitboard},
+	}
+	for _, slider := range sliders {
+		for x := slider.pieces; x != 0; x &= x - 1 {
+			s := uint8(bits.TrailingZeros64(x))
+			attacks := slider.moves(s, occupied)
+			for blockers := attacks & ourPieces.All; blockers != 0; blockers &= blockers - 1 {
+				blocker := blockers & -blockers
+				unmasked := slider.moves(s, occupied&^blocker) &^ attacks
+				if unmasked&enemyPieces.All != 0 {
+					candidates |= blocker
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// The value of a king in static exchange evaluation, large enough that capturing
+// with the king into a defended square never pays off.
+const seeKingValue = 20000
+
+// Returns the value of a piece type for static exchange evaluation.
+func seeValue(p Piece) int {
+	if p == King {
+		return seeKingValue
+	}
+	return int(pieceValues[p])
+}
+
+// Static exchange evaluation: the material the side to move expects to gain from
+// the move, in centipawns, if both sides keep recapturing on the destination square
+// with their least valuable attacker, and either side may stop when continuing
+// would lose material. Pins are not considered. Quiet moves are evaluated too, as
+// the material lost if the moved piece can be captured.
+func (b *Board) SEE(m Move) int {
+	ourPieces, oppPieces := &(b.White), &(b.Black)
+	if !b.Wtomove {
+		ourPieces, oppPieces = &(b.Black), &(b.White)
+	}
+	from, to := Square(m.From()), Square(m.To())
+	occupied := (b.White.All | b.Black.All) &^ (uint64(1) << from)
+	mover, _ := determinePieceType(ourPieces, uint64(1)<<from)
+	captured, _ := determinePieceType(oppPieces, uint64(1)<<to)
+	var gain [32]int
+	gain[0] = seeValue(captured)
+	if mover == Pawn && captured == Nothing && uint8(to) == b.enpassant && b.enpassant != 0 {
+		gain[0] = seeValue(Pawn)
+		if b.Wtomove {
+			occupied &^= uint64(1) << (to - 8)
+		} else {
+			occupied &^= uint64(1) << (to + 8)
+		}
+	}
+	onSquare := seeValue(mover)
+	if promote := m.Promote(); promote != Nothing {
+		gain[0] += seeValue(Piece(promote)) - seeValue(Pawn)
+		onSquare = seeValue(Piece(promote))
+	}
+	white := !b.Wtomove
+	depth := 0
+	for depth < len(gain)-1 {
+		attackers := b.attackersTo(to, white, occupied)
+		if attackers == 0 {
+			break
+		}
+		side := &(b.White)
+		if !white {
+			side = &(b.Black)
+		}
+		attacker, attackerBit := leastValuableAttacker(side, attackers)
+		depth++
+		gain[depth] = onSquare - gain[depth-1]
+		occupied &^= attackerBit
+		onSquare = seeValue(attacker)
+		white = !white
+	}
+	for ; depth > 0; depth-- {
+		if -gain[depth] < gain[depth-1] {
+			gain[depth-1] = -gain[depth]
+		}
+	}
+	return gain[0]
+}
+
+// Returns the least valuable piece among the attackers of one side, and its bit.
+func leastValuableAttacker(side *Bitboards, attackers uint64) (Piece, uint64) {
+	pieces := [...]struct {
+		piece    Piece
+		bitboard uint64
+	}{
+		{Pawn, side.Pawns}, {Knight, side.Knights}, {Bishop, side.Bishops},
+		{Rook, side.Rooks}, {Queen, side.Queens}, {King, side.Kings},
+	}
+	for _, p := range pieces {
+		if x := p.bitboard & attackers; x != 0 {
+			return p.piece, x & -x
+		}
+	}
+	return Nothing, 0
+}
+
+// Returns the squares adjacent to the king of the given color that it could step
+// to: those not occupied by friendly pieces and not attacked by the enemy. Attacks
+// are computed with the king removed from the board, so squares behind the king on
+// an enemy slider's line are not considered safe.
+func (b *Board) KingSafeSquares(white bool) uint64 {
+	ourPieces := &(b.White)
+	if !white {
+		ourPieces = &(b.Black)
+	}
+	king := b.kingSquare(white)
+	occupied := (b.White.All | b.Black.All) &^ ourPieces.Kings
+	var safe uint64
+	for x := kingMasks[king] &^ ourPieces.All; x != 0; x &= x - 1 {
+		s := Square(bits.TrailingZeros64(x))
+		if !b.IsSquareAttackedWith(s, !white, occupied) {
+			safe |= uint64(1) << s
+		}
+	}
+	return safe
+}
+
+// Returns, for each square, how many pieces of the given color attack it. Squares
+// holding the side's own pieces are included, so the count there is the number of
+// defenders. Pins are not considered.
+func (b *Board) ControlMap(white bool) [64]int8 {
+	var control [64]int8
+	b.forEachAttackSet(white, func(attacks uint64) {
+		for ; attacks != 0; attacks &= attacks - 1 {
+			control[bits.TrailingZeros64(attacks)]++
+		}
+	})
+	return control
+}
+
+// Returns every square attacked by at least one piece of the given color,
+// including squares holding the side's own pieces. Pins are not considered.
+func (b *Board) AttackMap(white bool) uint64 {
+	var attacked uint64
+	b.forEachAttackSet(white, func(attacks uint64) {
+		attacked |= attacks
+	})
+	return attacked
+}
+
+// Returns the pieces of each color that are attacked by the other color, the king
+// included if it is in check. Defenders and pins are not considered.
+func (b *Board) AttackedPieces() (whiteAttacked uint64, blackAttacked uint64) {
+	return b.White.All & b.AttackMap(false), b.Black.All & b.AttackMap(true)
+}
+
+// Returns the squares that the side to move attacks after the move but did not
+// attack before it, such as those along a file or diagonal that the move opens.
+func (b *Board) NewThreatsAfter(m Move) uint64 {
+	white := b.Wtomove
+	before := b.AttackMap(white)
+	unapply := b.Apply(m)
+	after := b.AttackMap(white)
+	unapply()
+	return after &^ before
+}
+
+// Calls fn with the attacked squares of each piece of the given color. Both pawn
+// attack directions are passed as separate sets, covering all pawns at once.
+func (b *Board) forEachAttackSet(white bool, fn func(attacks uint64)) {
+	pieces := &(b.White)
+	if !white {
+		pieces = &(b.Black)
+	}
+	occupied := b.White.All | b.Black.All
+	east, west := pawnAttackBitboards(pieces.Pawns, white)
+	fn(east)
+	fn(west)
+	for x := pieces.Knights; x != 0; x &= x - 1 {
+		fn(knightMasks[bits.TrailingZeros64(x)])
+	}
+	for x := pieces.Kings; x != 0; x &= x - 1 {
+		fn(kingMasks[bits.TrailingZeros64(x)])
+	}
+	for x := pieces.Bishops | pieces.Queens; x != 0; x &= x - 1 {
+		fn(CalculateBishopMoveBitboard(uint8(bits.TrailingZeros64(x)), occupied))
+	}
+	for x := pieces.Rooks | pieces.Queens; x != 0; x &= x - 1 {
+		fn(CalculateRookMoveBitboard(uint8(bits.TrailingZeros64(x)), occupied))
+	}
+}
+
+// Returns the legal moves of the piece on the given square that take it to safety:
+// to a square that no enemy piece attacks, or that is defended and attacked only
+// by pieces worth at least as much as it. This is meant for hints about saving a
+// hanging piece; it is empty if the piece is trapped, or if the square does not
+// hold a piece of the side to move.
+func (b *Board) EscapeMovesFor(s Square) []Move {
+	var escapes []Move
+	for _, m := range b.GenerateLegalMoves() {
+		if Square(m.From()) == s && b.movesToSafety(m) {
+			escapes = append(escapes, m)
+		}
+	}
+	return escapes
+}
+
+// Returns the legal moves that add a defender to the side to move's piece on the
+// given square: afterwards, a friendly piece attacks the square that did not
+// before, either the moved piece itself or one it uncovered. Moves of the piece
+// on the square are not included. This is meant for hints about protecting a
+// hanging piece; it is empty if the square does not hold a piece of the side to
+// move.
+func (b *Board) DefendingMovesFor(s Square) []Move {
+	white := b.Wtomove
+	ourPieces := &(b.White)
+	if !white {
+		ourPieces = &(b.Black)
+	}
+	if ourPieces.All&(uint64(1)<<s) == 0 {
+		return nil
+	}
+	defenders := b.AttackersTo(s, white)
+	var defending []Move
+	for _, m := range b.GenerateLegalMoves() {
+		if Square(m.From()) == s {
+			continue
+		}
+		before := defenders
+		if before&(uint64(1)<<m.From()) != 0 {
+			before |= uint64(1) << m.To()
+		}
+		unapply := b.Apply(m)
+		after := b.AttackersTo(s, white)
+		unapply()
+		if after&^before != 0 {
+			defending = append(defending, m)
+		}
+	}
+	return defending
+}
+
+// Returns the pieces of the given color, other than pawns and the king, that have
+// no legal move to safety in the sense of EscapeMovesFor(): every move lands on an
+// unsafe square, or the piece cannot move at all. If the given color is not to
+// move, its moves are generated as if it were. Whether the piece is attacked where
+// it stands is not considered.
+func (b *Board) TrappedPieces(white bool) uint64 {
+	position := b.detachedCopy()
+	if position.Wtomove != white {
+		position = b.WithSideToMoveFlipped()
+	}
+	ourPieces := &(position.White)
+	if !white {
+		ourPieces = &(position.Black)
+	}
+	trapped := ourPieces.Knights | ourPieces.Bishops | ourPieces.Rooks | ourPieces.Queens
+	for _, m := range position.GenerateLegalMoves() {
+		from := uint64(1) << m.From()
+		if trapped&from != 0 && position.movesToSafety(m) {
+			trapped &^= from
+		}
+	}
+	return trapped
+}
+
+// Whether the moved piece is safe after the move: not attacked, or defended and
+// attacked only by pieces worth at least as much as it.
+func (b *Board) movesToSafety(m Move) bool {
+	white := b.Wtomove
+	unapply := b.Apply(m)
+	defer unapply()
+	to := Square(m.To())
+	attackers := b.AttackersTo(to, !white)
+	if attackers == 0 {
+		return true
+	}
+	ourPieces, oppPieces := &(b.White), &(b.Black)
+	if !white {
+		ourPieces, oppPieces = &(b.Black), &(b.White)
+	}
+	piece, _ := determinePieceType(ourPieces, uint64(1)<<to)
+	attacker, _ := leastValuableAttacker(oppPieces, attackers)
+	return b.AttackersTo(to, white) != 0 && seeValue(attacker) >= seeValue(piece)
+}
+
+// A kind of tactical motif found by TacticalMotifs().
+type MotifKind uint8
+
+const (
+	// A slider attacks an enemy piece that shields a more valuable one, or the king.
+	MotifPin MotifKind = iota
+	// A slider attacks a valuable enemy piece, or the king, that has a less
+	// valuable one behind it, which is exposed once the front piece moves away.
+	MotifSkewer
+)
+
+// A tactical motif: the attacking piece of the side to move, and the two enemy
+// pieces lined up on its ray, nearest first.
+type Motif struct {
+	Kind     MotifKind
+	Attacker Square
+	Front    Square
+	Back     Square
+}
+
+// Returns the pins and skewers of the side to move: each bishop, rook or queen
+// that attacks an enemy piece with a second enemy piece directly behind it on the
+// same line. If the back piece is worth more, or is the king, it is a pin; if the
+// front piece is worth more, or is the king, it is a skewer. Two pieces of equal
+// value are neither. Motifs are ordered by the square of the attacking piece.
+func (b *Board) TacticalMotifs() []Motif {
+	ourPieces, oppPieces := &(b.White), &(b.Black)
+	if !b.Wtomove {
+		ourPieces, oppPieces = &(b.Black), &(b.White)
+	}
+	occupied := b.White.All | b.Black.All
+	sliders := []struct {
+		pieces  uint64
+		attacks func(uint8, uint64) uint64
+	}{
+		{ourPieces.Bishops | ourPieces.Queens, CalculateBishopMoveBitboard},
+		{ourPieces.Rooks | ourPieces.Queens, CalculateRookMoveBitboard},
+	}
+	var motifs []Motif
+	for x := ourPieces.Bishops | ourPieces.Rooks | ourPieces.Queens; x != 0; x &= x - 1 {
+		attacker := uint8(bits.TrailingZeros64(x))
+		for _, slider := range sliders {
+			if slider.pieces&(uint64(1)<<attacker) == 0 {
+				continue
+			}
+			attacks := slider.attacks(attacker, occupied)
+			for fronts := attacks & oppPieces.All; fronts != 0; fronts &= fronts - 1 {
+				front := Square(bits.TrailingZeros64(fronts))
+				// Lifting the front piece only uncovers squares behind it.
+				behind := slider.attacks(attacker, occupied&^(uint64(1)<<front)) &^ attacks
+				backs := behind & oppPieces.All
+				if backs == 0 {
+					continue
+				}
+				back := Square(bits.TrailingZeros64(backs))
+				frontType, _ := determinePieceType(oppPieces, uint64(1)<<front)
+				backType, _ := determinePieceType(oppPieces, uint64(1)<<back)
+				motif := Motif{Attacker: Square(attacker), Front: front, Back: back}
+				switch {
+				case seeValue(backType) > seeValue(frontType):
+					motif.Kind = MotifPin
+				case seeValue(frontType) > seeValue(backType):
+					motif.Kind = MotifSkewer
+				default:
+					continue
+				}
+				motifs = append(motifs, motif)
+			}
+		}
+	}
+	return motifs
+}
+
+// A move along with a score for ordering it, such as its SEE value.
+type ScoredMove struct {
+	Move  Move
+	Score int
+}
+
+// Returns the legal captures, including en passant, each scored by SEE().
+func (b *Board) GenerateCapturesWithSEE() []ScoredMove {
+	var captures []ScoredMove
+	for _, m := range b.GenerateLegalMoves() {
+		if IsCapture(m, b) {
+			captures = append(captures, ScoredMove{m, b.SEE(m)})
+		}
+	}
+	return captures
+}
+
+// Returns the index into the internal rook attack table that CalculateRookMoveBitboard()
+// uses for the square and occupancy, for building custom tables keyed the same way.
+// Indices are specific to this implementation's magic numbers, and may change
+// between versions; they range from 0 up to, but excluding, RookAttackTableSize(sq).
+func RookAttackIndex(sq Square, occupied uint64) int {
+	blockers := magicRookBlockerMasks[sq] & occupied
+	return int((blockers * magicNumberRook[sq]) >> magicRookShifts[sq])
+}
+
+// Like RookAttackIndex(), for bishops and CalculateBishopMoveBitboard().
+func BishopAttackIndex(sq Square, occupied uint64) int {
+	blockers := magicBishopBlockerMasks[sq] & occupied
+	return int((blockers * magicNumberBishop[sq]) >> magicBishopShifts[sq])
+}
+
+// Returns the number of entries in the internal rook attack table for the square.
+func RookAttackTableSize(sq Square) int {
+	return len(magicMovesRook[sq])
+}
+
+// Returns the number of entries in the internal bishop attack table for the square.
+func BishopAttackTableSize(sq Square) int {
+	return len(magicMovesBishop[sq])
+}
+
+// Returns the rook attack set stored at an index from RookAttackIndex().
+func RookAttacksAtIndex(sq Square, index int) uint64 {
+	return magicMovesRook[sq][index]
+}
+
+// Returns the bishop attack set stored at an index from BishopAttackIndex().
+func BishopAttacksAtIndex(sq Square, index int) uint64 {
+	return magicMovesBishop[sq][index]
+}
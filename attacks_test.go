@@ -0,0 +1,482 @@
+package dragontoothmg
+
+import (
+	"math/bits"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestAttackersTo(t *testing.T) {
+	b := ParseFen("3B4/8/1k4Rq/P1pP1P2/8/2p5/3K3r/1n2b3 w - - 0 0")
+	// d2 is attacked by the b1 knight, the e1 bishop, the c3 pawn, the h2 rook and the h6 queen
+	expected := uint64(1)<<algebraicToIndexFatal("b1") | uint64(1)<<algebraicToIndexFatal("e1") |
+		uint64(1)<<algebraicToIndexFatal("c3") | uint64(1)<<algebraicToIndexFatal("h2") |
+		uint64(1)<<algebraicToIndexFatal("h6")
+	if attackers := b.AttackersTo(Square(algebraicToIndexFatal("d2")), false); attackers != expected {
+		t.Error("Wrong attackers to d2. Expected", expected, "but got", attackers)
+	}
+	// c6 is attacked by the d5 pawn and the g6 rook, but not the d8 bishop
+	expected = uint64(1)<<algebraicToIndexFatal("d5") | uint64(1)<<algebraicToIndexFatal("g6")
+	if attackers := b.AttackersTo(Square(algebraicToIndexFatal("c6")), true); attackers != expected {
+		t.Error("Wrong attackers to c6. Expected", expected, "but got", attackers)
+	}
+	// pawn attacks must not wrap around the edge of the board
+	b2 := ParseFen("4k3/8/8/8/P6p/8/8/4K3 w - - 0 1")
+	if attackers := b2.AttackersTo(Square(algebraicToIndexFatal("h4")), true); attackers != 0 {
+		t.Error("White pawn attack wrapped around the board edge.")
+	}
+	if attackers := b2.AttackersTo(Square(algebraicToIndexFatal("a4")), false); attackers != 0 {
+		t.Error("Black pawn attack wrapped around the board edge.")
+	}
+}
+
+func TestAttackBreakdown(t *testing.T) {
+	b := ParseFen("3B4/8/1k4Rq/P1pP1P2/8/2p5/3K3r/1n2b3 w - - 0 0")
+	tests := []struct {
+		square   string
+		byWhite  bool
+		expected map[Piece]uint64
+	}{
+		{"d2", false, map[Piece]uint64{Pawn: bitboardOf("c3"), Knight: bitboardOf("b1"), Bishop: bitboardOf("e1"),
+			Rook: bitboardOf("h2"), Queen: bitboardOf("h6")}},
+		{"c6", true, map[Piece]uint64{Pawn: bitboardOf("d5"), Rook: bitboardOf("g6")}},
+		{"c2", true, map[Piece]uint64{King: bitboardOf("d2")}},
+		{"a8", true, map[Piece]uint64{}},
+	}
+	for _, test := range tests {
+		breakdown := b.AttackBreakdown(Square(algebraicToIndexFatal(test.square)), test.byWhite)
+		if len(breakdown) != len(test.expected) {
+			t.Error("Wrong attack breakdown for", test.square, "\nExpected", test.expected, "but got", breakdown)
+			continue
+		}
+		for p, origins := range test.expected {
+			if breakdown[p] != origins {
+				t.Error("Wrong attack breakdown for", test.square, "\nExpected", test.expected, "but got", breakdown)
+				break
+			}
+		}
+	}
+}
+
+func TestHangingPieces(t *testing.T) {
+	// The bishop on a4 is attacked by the b6 knight and undefended.
+	// The knight on e5 is attacked by the d6 pawn, but defended by the d4 pawn.
+	b := ParseFen("4k3/8/1n1p4/4N3/B2P4/8/8/4K3 w - - 0 1")
+	expected := uint64(1) << algebraicToIndexFatal("a4")
+	if hanging := b.HangingPieces(true); hanging != expected {
+		t.Error("Wrong hanging pieces for white. Expected", expected, "but got", hanging)
+	}
+	if hanging := b.HangingPieces(false); hanging != 0 {
+		t.Error("Wrong hanging pieces for black. Expected 0 but got", hanging)
+	}
+	// A king in check is never hanging.
+	b2 := ParseFen("4k3/8/8/8/8/8/8/r3K3 w - - 0 1")
+	if hanging := b2.HangingPieces(true); hanging != 0 {
+		t.Error("The king was reported as hanging.")
+	}
+}
+
+func TestIsSquareAttackedWith(t *testing.T) {
+	// The black rook on a8 is blocked from a1 by the white knight on a4.
+	b := ParseFen("r3k3/8/8/8/N7/8/8/4K3 w - - 0 1")
+	a1 := Square(algebraicToIndexFatal("a1"))
+	occupied := b.White.All | b.Black.All
+	if b.IsSquareAttackedWith(a1, false, occupied) {
+		t.Error("a1 should not be attacked with the actual occupancy.")
+	}
+	withoutKnight := occupied & ^bitboardOf("a4")
+	if !b.IsSquareAttackedWith(a1, false, withoutKnight) {
+		t.Error("a1 should be attacked once the knight moves away.")
+	}
+	// compare against the manually constructed position
+	moved := ParseFen("r3k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if moved.UnderDirectAttack(true, uint8(a1)) != b.IsSquareAttackedWith(a1, false, withoutKnight) {
+		t.Error("Hypothetical occupancy disagrees with the constructed position.")
+	}
+	// Removing the rook itself from the occupancy removes its attacks.
+	if b.IsSquareAttackedWith(a1, false, withoutKnight & ^bitboardOf("a8")) {
+		t.Error("A piece missing from the occupancy should not attack.")
+	}
+	// A hypothetical blocker shields a square from a slider.
+	b2 := ParseFen("4k3/8/8/8/8/8/8/R3K3 b - - 0 1")
+	a7 := Square(algebraicToIndexFatal("a7"))
+	occupied2 := b2.White.All | b2.Black.All
+	if !b2.IsSquareAttackedWith(a7, true, occupied2) {
+		t.Error("a7 should be attacked by the a1 rook.")
+	}
+	if b2.IsSquareAttackedWith(a7, true, occupied2|bitboardOf("a4")) {
+		t.Error("A hypothetical blocker on a4 should shield a7.")
+	}
+}
+
+func TestDiscoveredAttackCandidates(t *testing.T) {
+	positions := map[string][2]uint64{
+		// the d3 knight masks the b1 bishop's attack on the g6 queen
+		"4k3/8/6q1/8/8/3N4/8/KB6 w - - 0 1": {bitboardOf("d3"), 0},
+		// the e4 pawn masks a discovered check; the c3 knight masks nothing
+		"4k3/8/8/8/4P3/2N5/8/R3R1K1 w - - 0 1": {bitboardOf("e4"), 0},
+		// the d8 bishop masks the a8 rook's attack on the h8 queen
+		"r2b3Q/8/8/8/8/8/8/4K2k b - - 0 1": {0, bitboardOf("d8")},
+		// only the first of two blockers is considered
+		"rbb4Q/8/8/8/8/8/8/4K2k b - - 0 1": {0, 0},
+		// the a2 pawn masks the a1 rook's attack on the a7 pawn
+		"4k3/p7/8/8/8/8/P7/R3K3 w - - 0 1": {bitboardOf("a2"), 0},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if candidates := b.DiscoveredAttackCandidates(true); candidates != v[0] {
+			t.Error("Wrong white discovered attack candidates for", k, "\nExpected", v[0], "but got", candidates)
+		}
+		if candidates := b.DiscoveredAttackCandidates(false); candidates != v[1] {
+			t.Error("Wrong black discovered attack candidates for", k, "\nExpected", v[1], "but got", candidates)
+		}
+	}
+}
+
+func TestSEE(t *testing.T) {
+	positions := []struct {
+		fen  string
+		move string
+		see  int
+	}{
+		// an undefended pawn
+		{"4k3/8/8/3p4/8/8/8/3RK3 w - - 0 1", "d1d5", 100},
+		// a defended pawn, taken by a rook
+		{"4k3/8/4p3/3p4/8/8/8/3RK3 w - - 0 1", "d1d5", -400},
+		// a defended pawn, taken by a pawn
+		{"4k3/8/4p3/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", 0},
+		// the second rook x-rays through the first
+		{"4k3/8/3r4/3p4/8/8/3R4/3RK3 w - - 0 1", "d2d5", 100},
+		// a quiet move onto a square attacked by a pawn
+		{"4k3/8/8/8/2p5/8/8/1N2K3 w - - 0 1", "b1d2", 0},
+		{"4k3/8/8/8/4p3/8/8/1N2K3 w - - 0 1", "b1d3", -300},
+		// the king cannot capture a defended piece
+		{"4k3/8/8/8/8/2b5/3n4/4K3 w - - 0 1", "e1d2", -19700},
+		// en passant, recaptured by a pawn
+		{"4k3/5p2/8/3Pp3/8/8/8/4K3 w - e6 0 1", "d5e6", 0},
+		// en passant, not recaptured
+		{"4k3/2p5/8/3Pp3/8/8/8/4K3 w - e6 0 1", "d5e6", 100},
+		// a promotion that cannot be recaptured
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", 800},
+	}
+	for _, v := range positions {
+		b := ParseFen(v.fen)
+		if see := b.SEE(parseMove(v.move)); see != v.see {
+			t.Error("Wrong SEE for", v.move, "in", v.fen, "\nExpected", v.see, "but got", see)
+		}
+		if b.ToFen() != v.fen {
+			t.Error("SEE corrupted board state for", v.fen)
+		}
+	}
+}
+
+func TestKingSafeSquares(t *testing.T) {
+	positions := []struct {
+		fen   string
+		white bool
+		safe  uint64
+	}{
+		{Startpos, true, 0},
+		{Startpos, false, 0},
+		{"6k1/8/8/8/8/8/r7/4K3 w - - 0 1", true, bitboardOf("d1", "f1")},
+		// the square behind the king on the rook's rank is attacked too
+		{"4k3/8/8/8/8/8/8/r3K3 w - - 0 1", true, bitboardOf("d2", "e2", "f2")},
+		// the queen can be captured unless it is defended
+		{"4k3/8/8/8/8/8/3qP3/4K3 w - - 0 1", true, bitboardOf("d2", "f1", "f2")},
+		{"4k3/8/8/8/8/2p5/3qP3/4K3 w - - 0 1", true, bitboardOf("f1", "f2")},
+		{"4k3/8/8/8/8/2p5/3qP3/4K3 w - - 0 1", false, bitboardOf("d8", "f8", "d7", "e7", "f7")},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if safe := b.KingSafeSquares(p.white); safe != p.safe {
+			t.Error("Wrong safe king squares for", p.fen, "white:", p.white, "\nExpected", p.safe, "but got", safe)
+		}
+	}
+}
+
+func TestControlMap(t *testing.T) {
+	b := ParseFen("4k3/8/8/8/8/2N5/3P4/R2QK3 w - - 0 1")
+	expected := map[string]int8{
+		"e4": 1, // knight
+		"b1": 3, // rook, queen and knight
+		"c3": 1, // d2 pawn defends the knight
+		"e3": 1, // pawn
+		"d2": 2, // queen and king defend the pawn
+		"e2": 3, // queen, king and knight
+		"c1": 2, // rook and queen
+		"a8": 1, // rook
+		"h6": 0,
+	}
+	control := b.ControlMap(true)
+	for square, count := range expected {
+		if c := control[algebraicToIndexFatal(square)]; c != count {
+			t.Error("Wrong control count on", square, "\nExpected", count, "but got", c)
+		}
+	}
+	// every square attacked by a piece has a nonzero count, and no other square does
+	for s := Square(0); s < 64; s++ {
+		attacked := b.AttackersTo(s, true)
+		if count := control[s]; int(count) != bits.OnesCount64(attacked) {
+			t.Error("Control count on", IndexToAlgebraic(s), "does not match the attackers:", count)
+		}
+	}
+}
+
+func TestAttackMap(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	for _, white := range []bool{true, false} {
+		control := b.ControlMap(white)
+		attacked := b.AttackMap(white)
+		for s := Square(0); s < 64; s++ {
+			if (control[s] != 0) != (attacked&(uint64(1)<<s) != 0) {
+				t.Error("Attack map does not match the control map on", IndexToAlgebraic(s))
+			}
+		}
+	}
+	start := ParseFen(Startpos)
+	if attacked := start.AttackMap(true); attacked != onlyRank[0]&^bitboardOf("a1", "h1")|onlyRank[1]|onlyRank[2] {
+		t.Error("Wrong attack map for the starting position:", attacked)
+	}
+}
+
+func TestNewThreatsAfter(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected uint64
+	}{
+		// the bishop and queen diagonals open
+		{Startpos, "e2e4", bitboardOf("d5", "f5", "g4", "h5", "c4", "b5", "a6")},
+		// the knight uncovers the rook's file
+		{"4k3/8/8/8/8/8/4N3/4R1K1 w - - 0 1", "e2c3",
+			bitboardOf("a2", "a4", "b5", "d5", "e3", "e4", "e5", "e6", "e7", "e8")},
+		{"4k3/8/8/8/8/8/4N3/4R1K1 w - - 0 1", "g1h1", 0},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if threats := b.NewThreatsAfter(parseMove(test.move)); threats != test.expected {
+			t.Error("Wrong new threats after", test.move, "in", test.fen, "\nExpected", test.expected, "but got", threats)
+		}
+		if b.ToFen() != test.fen {
+			t.Error("Computing new threats modified the board.")
+		}
+	}
+}
+
+func TestEscapeMovesFor(t *testing.T) {
+	tests := []struct {
+		fen      string
+		square   string
+		expected string
+	}{
+		{"1r2k3/8/8/4p3/3N4/8/8/4K3 w - - 0 1", "d4", "d4c2 d4c6 d4e2 d4e6 d4f3 d4f5"},
+		// e2 is attacked by a knight, but defended by the king
+		{"4k3/8/8/4p3/3N4/8/8/2n1K3 w - - 0 1", "d4", "d4b5 d4c2 d4c6 d4e2 d4e6 d4f3 d4f5"},
+		// the knight is trapped in the corner
+		{"N2k4/1pp5/8/8/8/8/8/4K3 w - - 0 1", "a8", ""},
+		{"N2k4/1pp5/8/8/8/8/8/4K3 w - - 0 1", "e4", ""},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		moves := b.EscapeMovesFor(Square(algebraicToIndexFatal(test.square)))
+		SortMoves(moves)
+		if line := WriteUCILine(moves); line != test.expected {
+			t.Error("Wrong escape moves for", test.square, "in", test.fen, "\nExpected", test.expected, "but got", line)
+		}
+		if b.ToFen() != test.fen {
+			t.Error("Finding escape moves modified the board.")
+		}
+	}
+}
+
+func TestDefendingMovesFor(t *testing.T) {
+	tests := []struct {
+		fen      string
+		square   string
+		expected string
+	}{
+		{"3r3k/8/8/8/3N4/8/8/R5K1 w - - 0 1", "d4", "a1a4 a1d1"},
+		// the pawn uncovers the bishop's defense
+		{"3r3k/8/8/8/3N4/8/1P6/B5K1 w - - 0 1", "d4", "b2b3 b2b4"},
+		// nothing can come to the knight's aid
+		{"3r3k/8/8/8/3N4/8/8/6K1 w - - 0 1", "d4", ""},
+		{"3r3k/8/8/8/3N4/8/8/R5K1 w - - 0 1", "e4", ""},
+		{"3r3k/8/8/8/3N4/8/8/R5K1 w - - 0 1", "d8", ""},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		moves := b.DefendingMovesFor(Square(algebraicToIndexFatal(test.square)))
+		SortMoves(moves)
+		if line := WriteUCILine(moves); line != test.expected {
+			t.Error("Wrong defending moves for", test.square, "in", test.fen, "\nExpected", test.expected, "but got", line)
+		}
+		if b.ToFen() != test.fen {
+			t.Error("Finding defending moves modified the board.")
+		}
+	}
+}
+
+func TestAttackedPieces(t *testing.T) {
+	positions := map[string][2]uint64{
+		Startpos: {0, 0},
+		// the knights attack each other
+		"4k3/8/2r5/3n4/8/4N3/8/B3K3 w - - 0 1": {bitboardOf("e3"), bitboardOf("d5")},
+		// the knight is attacked twice, by the rook and the knight
+		"4k3/8/2r5/3n4/8/2N5/8/B3K3 w - - 0 1": {bitboardOf("c3"), bitboardOf("d5")},
+		"r3k3/8/8/8/8/8/8/R3K3 w - - 0 1":      {bitboardOf("a1"), bitboardOf("a8")},
+		"4k3/8/8/8/8/8/8/r3K3 w - - 0 1":       {bitboardOf("e1"), 0},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if white, black := b.AttackedPieces(); white != v[0] || black != v[1] {
+			t.Error("Wrong attacked pieces for", k, "\nExpected", v, "but got", white, black)
+		}
+	}
+}
+
+func TestGenerateCapturesWithSEE(t *testing.T) {
+	positions := map[string]int{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1": 8,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1": 7,
+		"4k3/5p2/8/3Pp3/8/8/8/4K3 w - e6 0 1":                                  1,
+		"4k3/8/8/8/8/8/p7/4K3 b - - 0 1":                                       0,
+		Startpos:                                                               0,
+	}
+	for fen, count := range positions {
+		b := ParseFen(fen)
+		captures := b.GenerateCapturesWithSEE()
+		if len(captures) != count {
+			t.Error("Wrong number of captures for", fen, "\nExpected", count, "but got", len(captures))
+		}
+		for _, c := range captures {
+			if !IsCapture(c.Move, &b) {
+				t.Error("Generated a non-capture:", &c.Move)
+			}
+			if see := b.SEE(c.Move); c.Score != see {
+				t.Error("Wrong SEE for", &c.Move, "in", fen, "\nExpected", see, "but got", c.Score)
+			}
+		}
+	}
+}
+
+func BenchmarkGenerateCapturesWithSEE(b *testing.B) {
+	boards := batchTestPositions(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range boards {
+			captures := boards[j].GenerateCapturesWithSEE()
+			sort.Slice(captures, func(x, y int) bool {
+				return captures[x].Score > captures[y].Score
+			})
+		}
+	}
+}
+
+// Computes SEE inside the sort comparator, as move ordering without cached
+// scores must.
+func BenchmarkGenerateCapturesThenSEE(b *testing.B) {
+	boards := batchTestPositions(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range boards {
+			board := &boards[j]
+			captures := FilterMoves(board.GenerateLegalMoves(), func(m Move) bool {
+				return IsCapture(m, board)
+			})
+			sort.Slice(captures, func(x, y int) bool {
+				return board.SEE(captures[x]) > board.SEE(captures[y])
+			})
+		}
+	}
+}
+
+func TestTrappedPieces(t *testing.T) {
+	positions := []struct {
+		fen     string
+		white   bool
+		trapped uint64
+	}{
+		// the bishop on a7 can only move to b8 or take on b6, and loses either way
+		{"2k5/B1p5/1p6/8/3N4/8/8/4K3 w - - 0 1", true, bitboardOf("a7")},
+		{"2k5/B1p5/1p6/8/3N4/8/8/4K3 b - - 0 1", true, bitboardOf("a7")},
+		// with the c7 pawn gone, the bishop can take on b6
+		{"2k5/B7/1p6/8/3N4/8/8/4K3 w - - 0 1", true, 0},
+		// the rook cannot move, and the knight is trapped in the corner
+		{"n3k3/2P5/1P6/P7/8/8/PP6/RK6 b - - 0 1", true, bitboardOf("a1")},
+		{"n3k3/2P5/1P6/P7/8/8/PP6/RK6 b - - 0 1", false, bitboardOf("a8")},
+		{Startpos, true, bitboardOf("a1", "c1", "d1", "f1", "h1")},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if trapped := b.TrappedPieces(p.white); trapped != p.trapped {
+			t.Error("Wrong trapped pieces for", p.fen, "white:", p.white, "\nExpected", p.trapped, "but got", trapped)
+		}
+		if b.ToFen() != p.fen {
+			t.Error("Finding trapped pieces modified the board.")
+		}
+	}
+}
+
+func TestAttackIndices(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 10000; i++ {
+		sq := Square(r.Intn(64))
+		occupied := r.Uint64() & r.Uint64()
+		rookIndex := RookAttackIndex(sq, occupied)
+		if rookIndex < 0 || rookIndex >= RookAttackTableSize(sq) {
+			t.Fatal("Rook attack index out of range:", rookIndex)
+		}
+		if RookAttacksAtIndex(sq, rookIndex) != CalculateRookMoveBitboard(uint8(sq), occupied) {
+			t.Error("Rook attack index does not match the attack set for", IndexToAlgebraic(sq), occupied)
+		}
+		bishopIndex := BishopAttackIndex(sq, occupied)
+		if bishopIndex < 0 || bishopIndex >= BishopAttackTableSize(sq) {
+			t.Fatal("Bishop attack index out of range:", bishopIndex)
+		}
+		if BishopAttacksAtIndex(sq, bishopIndex) != CalculateBishopMoveBitboard(uint8(sq), occupied) {
+			t.Error("Bishop attack index does not match the attack set for", IndexToAlgebraic(sq), occupied)
+		}
+	}
+	// blockers outside the rook's rays do not change the index
+	if RookAttackIndex(0, 0) != RookAttackIndex(0, bitboardOf("c3", "h8")) {
+		t.Error("Irrelevant blockers changed the rook attack index.")
+	}
+}
+
+func TestTacticalMotifs(t *testing.T) {
+	sq := func(alg string) Square {
+		return Square(algebraicToIndexFatal(alg))
+	}
+	tests := []struct {
+		fen      string
+		expected []Motif
+	}{
+		// the bishop skewers the queen to the rook behind it
+		{"4k3/8/8/6r1/8/4q3/8/2B4K w - - 0 1", []Motif{{MotifSkewer, sq("c1"), sq("e3"), sq("g5")}}},
+		{"3k4/8/8/3n4/8/8/8/3R2K1 w - - 0 1", []Motif{{MotifPin, sq("d1"), sq("d5"), sq("d8")}}},
+		{"4k3/8/2n5/8/Q7/8/8/6K1 w - - 0 1", []Motif{{MotifPin, sq("a4"), sq("c6"), sq("e8")}}},
+		{"4k3/8/8/1b6/8/3N4/8/5K2 b - - 0 1", []Motif{{MotifPin, sq("b5"), sq("d3"), sq("f1")}}},
+		// two rooks of equal value are neither pinned nor skewered
+		{"r3k3/8/8/r7/8/8/8/R5K1 w - - 0 1", nil},
+		// a friendly piece in between blocks the line
+		{"3k4/8/8/3n4/8/8/3P4/3R2K1 w - - 0 1", nil},
+		// only the piece directly behind counts, here the pawn rather than the king
+		{"3k4/3p4/8/3n4/8/8/8/3R2K1 w - - 0 1", []Motif{{MotifSkewer, sq("d1"), sq("d5"), sq("d7")}}},
+		{Startpos, nil},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		motifs := b.TacticalMotifs()
+		if len(motifs) != len(test.expected) {
+			t.Error("Wrong tactical motifs for", test.fen, "\nExpected", test.expected, "but got", motifs)
+			continue
+		}
+		for i := range motifs {
+			if motifs[i] != test.expected[i] {
+				t.Error("Wrong tactical motifs for", test.fen, "\nExpected", test.expected, "but got", motifs)
+				break
+			}
+		}
+	}
+}
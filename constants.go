@@ -183,6 +183,9 @@ const kDefaultMoveListLength int = 65
 // Bitboard where every bit is active
 var everything uint64 = ^(uint64(0))
 
+// Bitboard of the light squares (A1 is dark)
+var lightSquares uint64 = 0x55AA55AA55AA55AA
+
 // Only activate one file, A-H (A=0, H=7)
 var onlyFile = [8]uint64{
 	0x0101010101010101, 0x0202020202020202, 0x0404040404040404, 0x0808080808080808,
@@ -0,0 +1,120 @@
+package dragontoothmg
+
+// A compact, fixed-size binary encoding for boards.
+//
+// Every encoded board is exactly BinaryBoardSize bytes:
+// 8 bytes:  occupancy bitboard (little-endian)
+// 16 bytes: one 4-bit code per occupied square, in ascending square order,
+//           low nibble first. The code is the Piece, plus 8 for black pieces.
+// 1 byte:   flags; bit 0 is set if white is to move, bits 1-4 hold the castling rights
+// 1 byte:   en passant square (0 if none)
+// 1 byte:   halfmove clock
+// 2 bytes:  fullmove number (little-endian)
+// 2 bytes:  castling rook files, one nibble per castling right in the order of the
+//           castling rights bits, low nibble first: the file plus one, if a Chess960
+//           FEN named the rook's file, and otherwise 0
+// 1 byte:   reserved, always zero
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// The size in bytes of every board produced by MarshalBinary().
+const BinaryBoardSize = 32
+
+// Encodes the board into BinaryBoardSize bytes. Returns an error if the board has
+// more than 32 pieces, which cannot happen in a legal position.
+func (b *Board) MarshalBinary() ([]byte, error) {
+	data := make([]byte, BinaryBoardSize)
+	occupied := b.White.All | b.Black.All
+	if bits.OnesCount64(occupied) > 32 {
+		return nil, errors.New("Cannot encode a board with more than 32 pieces.")
+	}
+	binary.LittleEndian.PutUint64(data[0:8], occupied)
+	for i := 0; occupied != 0; i++ {
+		square := uint64(1) << uint(bits.TrailingZeros64(occupied))
+		occupied &= occupied - 1
+		code, _ := determinePieceType(&(b.White), square)
+		if code == Nothing {
+			code, _ = determinePieceType(&(b.Black), square)
+			code |= 8
+		}
+		data[8+i/2] |= byte(code) << (4 * uint(i%2))
+	}
+	if b.Wtomove {
+		data[24] |= 1
+	}
+	data[24] |= b.castlerights << 1
+	data[25] = b.enpassant
+	data[26] = b.Halfmoveclock
+	binary.LittleEndian.PutUint16(data[27:29], b.Fullmoveno)
+	for i, file := range b.castleFiles {
+		data[29+i/2] |= file << (4 * uint(i%2))
+	}
+	return data, nil
+}
+
+// Decodes a board produced by MarshalBinary().
+func UnmarshalBinary(data []byte) (Board, error) {
+	var b Board
+	if len(data) != BinaryBoardSize {
+		return b, errors.New("Encoded board has the wrong length.")
+	}
+	occupied := binary.LittleEndian.Uint64(data[0:8])
+	if bits.OnesCount64(occupied) > 32 {
+		return b, errors.New("Encoded board has more than 32 pieces.")
+	}
+	for i := 0; occupied != 0; i++ {
+		square := uint64(1) << uint(bits.TrailingZeros64(occupied))
+		occupied &= occupied - 1
+		code := (data[8+i/2] >> (4 * uint(i%2))) & 0xF
+		side := &(b.White)
+		if code&8 != 0 {
+			side = &(b.Black)
+		}
+		switch Piece(code & 7) {
+		case Pawn:
+			side.Pawns |= square
+		case Knight:
+			side.Knights |= square
+		case Bishop:
+			side.Bishops |= square
+		case Rook:
+			side.Rooks |= square
+		case Queen:
+			side.Queens |= square
+		case King:
+			side.Kings |= square
+		default:
+			return Board{}, errors.New("Encoded board has an invalid piece code.")
+		}
+		side.All |= square
+	}
+	if data[24]>>5 != 0 || data[25] > 63 || data[31] != 0 {
+		return Board{}, errors.New("Encoded board has invalid state bytes.")
+	}
+	b.Wtomove = data[24]&1 == 1
+	b.castlerights = data[24] >> 1
+	for i := range b.castleFiles {
+		file := (data[29+i/2] >> (4 * uint(i%2))) & 0xF
+		if file > 8 || (file != 0 && b.castlerights&(1<<uint(i)) == 0) {
+			return Board{}, errors.New("Encoded board has invalid castling rook files.")
+		}
+		b.castleFiles[i] = file
+		rooks := b.White.Rooks
+		if i >= 2 {
+			rooks = b.Black.Rooks
+		}
+		if file != 0 && rooks&(uint64(1)<<b.castlingRookSquare(CastleRights(1)<<uint(i))) == 0 {
+			return Board{}, errors.New("Encoded board has invalid castling rook files.")
+		}
+	}
+	b.enpassant = data[25]
+	b.Halfmoveclock = data[26]
+	b.Fullmoveno = binary.LittleEndian.Uint16(data[27:29])
+	b.hash = recomputeBoardHash(&b)
+	b.material = int16(b.Material())
+	return b, nil
+}
@@ -0,0 +1,102 @@
+package dragontoothmg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	boards := batchTestPositions(1000)
+	boards = append(boards, ParseFen("1Q2rk2/2p2p2/1n4b1/N7/2B1Pp1q/2B4P/1QPP4/4K2R b K e3 4 30"),
+		ParseFen("6nq/6p1/2B4n/1rB2r1R/5q2/2P5/1Q4n1/2B5 b - - 2 999"))
+	for i := range boards {
+		data, err := boards[i].MarshalBinary()
+		if err != nil {
+			t.Error("Failed to encode", boards[i].ToFen(), ":", err)
+			continue
+		}
+		if len(data) != BinaryBoardSize {
+			t.Error("Encoding has the wrong length:", len(data))
+		}
+		decoded, err := UnmarshalBinary(data)
+		if err != nil {
+			t.Error("Failed to decode", boards[i].ToFen(), ":", err)
+			continue
+		}
+		if decoded.ToFen() != boards[i].ToFen() || decoded.Hash() != boards[i].Hash() {
+			t.Error("Binary round trip failed.\nOutput:  ", decoded.ToFen(), "\nExpected:", boards[i].ToFen())
+		}
+		// the encoding is stable
+		again, _ := decoded.MarshalBinary()
+		if !bytes.Equal(data, again) {
+			t.Error("Encoding is not stable for", boards[i].ToFen())
+		}
+	}
+}
+
+func TestBinaryEncodingFormat(t *testing.T) {
+	b := ParseFen(Startpos)
+	data, _ := b.MarshalBinary()
+	expected := []byte{
+		0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, // occupancy
+		0x24, 0x53, 0x36, 0x42, 0x11, 0x11, 0x11, 0x11, // white pieces
+		0x99, 0x99, 0x99, 0x99, 0xAC, 0xDB, 0xBE, 0xCA, // black pieces
+		0x1F, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // state
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Wrong encoding for the start position: %X", data)
+	}
+	invalid := [][]byte{
+		data[:31],
+		append(append([]byte{}, data[:8]...), make([]byte, 24)...), // piece codes of zero
+	}
+	for _, d := range invalid {
+		if _, err := UnmarshalBinary(d); err == nil {
+			t.Error("Decoded an invalid encoding without error.")
+		}
+	}
+}
+
+func TestBinaryChess960RoundTrip(t *testing.T) {
+	fens := []string{
+		"1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3KR1 w GBgb - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3K1R b Bgb - 1 1",
+	}
+	for _, fen := range fens {
+		b, err := ParseFenSafe(fen)
+		if err != nil {
+			t.Error("Failed to parse Chess960 FEN", fen, ":", err)
+			continue
+		}
+		data, err := b.MarshalBinary()
+		if err != nil {
+			t.Error("Failed to encode", fen, ":", err)
+			continue
+		}
+		decoded, err := UnmarshalBinary(data)
+		if err != nil {
+			t.Error("Failed to decode", fen, ":", err)
+			continue
+		}
+		if decoded.ToFen() != fen || decoded.Hash() != b.Hash() {
+			t.Error("Chess960 binary round trip failed.\nOutput:  ", decoded.ToFen(), "\nExpected:", fen)
+		}
+	}
+	// rook files must belong to held rights, with a rook on the file
+	b, _ := ParseFenSafe(fens[0])
+	data, _ := b.MarshalBinary()
+	invalid := [][]byte{
+		append(append([]byte{}, data[:29]...), 0x09, 0x00, 0x00), // file out of range
+		append(append([]byte{}, data[:29]...), 0x33, 0x33, 0x00), // no rook on the c-file
+	}
+	noRights := ParseFen("1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3KR1 w - - 0 1")
+	noRightsData, _ := noRights.MarshalBinary()
+	noRightsData[29] = 0x72 // files for rights the board does not hold
+	invalid = append(invalid, noRightsData)
+	for _, d := range invalid {
+		if _, err := UnmarshalBinary(d); err == nil {
+			t.Error("Decoded invalid castling rook files without error.")
+		}
+	}
+}
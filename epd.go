@@ -0,0 +1,148 @@
+package dragontoothmg
+
+// Reading and writing EPD (Extended Position Description) lines, as used by
+// position test suites.
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Parses an EPD line into a board and its operations. The operations map each
+// opcode (such as "bm" or "id") to its operands, with enclosing quotes removed
+// and the escapes \" and \\ inside them undone.
+// Move operands are kept verbatim, in whatever notation the line uses.
+// If the "hmvc" and "fmvn" operations are present, they set the board's clocks.
+func ParseEPD(line string) (Board, map[string]string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return Board{}, nil, errors.New("EPD must have at least 4 fields: " + line)
+	}
+	ops, err := parseEPDOperations(strings.Join(fields[4:], " "))
+	if err != nil {
+		return Board{}, nil, err
+	}
+	halfmove, fullmove := "0", "1"
+	if v, ok := ops["hmvc"]; ok {
+		halfmove = v
+	}
+	if v, ok := ops["fmvn"]; ok {
+		fullmove = v
+	}
+	b, err := ParseFenSafe(strings.Join(fields[:4], " ") + " " + halfmove + " " + fullmove)
+	if err != nil {
+		return Board{}, nil, err
+	}
+	return b, ops, nil
+}
+
+// Splits the operations portion of an EPD line, respecting quoted operands.
+func parseEPDOperations(s string) (map[string]string, error) {
+	ops := make(map[string]string)
+	var current string
+	inQuotes, escaped := false, false
+	var raw []string
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+			current += string(c)
+		case c == '\\' && inQuotes:
+			escaped = true
+			current += string(c)
+		case c == '"':
+			inQuotes = !inQuotes
+			current += string(c)
+		case c == ';' && !inQuotes:
+			raw = append(raw, current)
+			current = ""
+		default:
+			current += string(c)
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("Unterminated quote in EPD operations: " + s)
+	}
+	if strings.TrimSpace(current) != "" {
+		return nil, errors.New("EPD operation is missing its semicolon: " + current)
+	}
+	for _, op := range raw {
+		op = strings.TrimSpace(op)
+		if op == "" {
+			continue
+		}
+		opcode := op
+		value := ""
+		if i := strings.IndexAny(op, " \t"); i >= 0 {
+			opcode, value = op[:i], strings.TrimSpace(op[i:])
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = epdUnescaper.Replace(value[1 : len(value)-1])
+		}
+		ops[opcode] = value
+	}
+	return ops, nil
+}
+
+// Writes a board and a set of operations as an EPD line. The operations are
+// written in sorted order of their opcodes. String-valued operations ("id" and
+// the "c0" to "c9" comments) are quoted, with backslashes and quotes escaped.
+// Operands of the move-valued operations ("bm", "am", "pm" and "sm") that are
+// legal UCI moves on the board are converted to SAN, as EPD requires; all other
+// operands are written verbatim.
+func WriteEPD(b *Board, ops map[string]string) string {
+	fields := strings.Fields(b.ToFen())
+	line := strings.Join(fields[:4], " ")
+	opcodes := make([]string, 0, len(ops))
+	for opcode := range ops {
+		opcodes = append(opcodes, opcode)
+	}
+	sort.Strings(opcodes)
+	for _, opcode := range opcodes {
+		value := ops[opcode]
+		if isEPDMoveOperation(opcode) {
+			value = epdMovesToSAN(b, value)
+		}
+		if isEPDStringOperation(opcode) || strings.Contains(value, ";") {
+			value = `"` + epdEscaper.Replace(value) + `"`
+		}
+		if value == "" {
+			line += " " + opcode + ";"
+		} else {
+			line += " " + opcode + " " + value + ";"
+		}
+	}
+	return line
+}
+
+// Escape the backslashes and quotes in quoted EPD operands, and undo it.
+var (
+	epdEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	epdUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+)
+
+// Whether the EPD opcode takes moves as its operands.
+func isEPDMoveOperation(opcode string) bool {
+	return opcode == "bm" || opcode == "am" || opcode == "pm" || opcode == "sm"
+}
+
+// Converts each space-separated operand that is a legal UCI move on the board to
+// SAN, leaving the rest (such as moves already in SAN) unchanged.
+func epdMovesToSAN(b *Board, operands string) string {
+	moves := strings.Fields(operands)
+	for i, operand := range moves {
+		if m, err := ParseMove(operand); err == nil && !m.IsNull() && b.isLegalMove(m) {
+			moves[i] = b.ToSAN(m)
+		}
+	}
+	return strings.Join(moves, " ")
+}
+
+// Whether the EPD opcode takes a single string operand.
+func isEPDStringOperation(opcode string) bool {
+	if opcode == "id" {
+		return true
+	}
+	return len(opcode) == 2 && opcode[0] == 'c' && opcode[1] >= '0' && opcode[1] <= '9'
+}
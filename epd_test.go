@@ -0,0 +1,100 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestParseEPD(t *testing.T) {
+	b, ops, err := ParseEPD(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";`)
+	if err != nil {
+		t.Error("Failed to parse EPD:", err)
+	}
+	if b.ToFen() != "2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1" {
+		t.Error("Wrong position parsed from EPD:", b.ToFen())
+	}
+	if len(ops) != 2 || ops["bm"] != "Qg6" || ops["id"] != "WAC.001" {
+		t.Error("Wrong operations parsed from EPD:", ops)
+	}
+	b2, _, err := ParseEPD(`8/8/4k3/8/8/2K5/8/8 b - - hmvc 12; fmvn 40;`)
+	if err != nil || b2.Halfmoveclock != 12 || b2.Fullmoveno != 40 {
+		t.Error("EPD clock operations were not applied:", b2.ToFen(), err)
+	}
+	invalid := []string{
+		"8/8/4k3/8/8/2K5/8/8 b -",
+		`8/8/4k3/8/8/2K5/8/8 b - - id "unterminated;`,
+		"8/8/4k3/8/8/2K5/8/8 b - - bm Kd7",
+		"8/8/4k3/8/8/8/8/8 b - - bm Kd7;",
+	}
+	for _, line := range invalid {
+		if _, _, err := ParseEPD(line); err == nil {
+			t.Error("Parsed an invalid EPD without error:", line)
+		}
+	}
+}
+
+func TestEPDRoundTrip(t *testing.T) {
+	lines := []string{
+		`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";`,
+		`r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - am Qxh3; bm Qd1 O-O-O; c0 "kiwipete; a comment"; id "perft 2";`,
+		`rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 id "open";`,
+		`8/8/4k3/8/8/2K5/8/8 b - -`,
+		`8/8/4k3/8/8/2K5/8/8 b - - c0 "a\\b"; id "say \"hi\"";`,
+	}
+	for _, line := range lines {
+		b, ops, err := ParseEPD(line)
+		if err != nil {
+			t.Error("Failed to parse EPD", line, ":", err)
+			continue
+		}
+		written := WriteEPD(&b, ops)
+		if written != line {
+			t.Error("EPD round trip failed.\nOutput:  ", written, "\nExpected:", line)
+		}
+		b2, ops2, err := ParseEPD(written)
+		if err != nil {
+			t.Error("Failed to reparse written EPD", written, ":", err)
+			continue
+		}
+		if b2.ToFen() != b.ToFen() || len(ops2) != len(ops) {
+			t.Error("Reparsed EPD differs for", line)
+		}
+		for k, v := range ops {
+			if ops2[k] != v {
+				t.Error("Reparsed EPD operation", k, "differs for", line)
+			}
+		}
+	}
+}
+
+func TestWriteEPDMovesAsSAN(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	ops := map[string]string{"bm": "e1c1 f3h3", "am": "e5f7", "pm": "Qd1", "sm": "a1a8", "id": "e2e4"}
+	written := WriteEPD(&b, ops)
+	// a1a8 is not legal, and id is not a move operation
+	expected := `r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - am Nxf7; bm O-O-O Qxh3; id "e2e4"; pm Qd1; sm a1a8;`
+	if written != expected {
+		t.Error("Wrong moves in written EPD\nExpected", expected, "but got", written)
+	}
+	if b.ToFen() != "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1" {
+		t.Error("Writing EPD modified the board.")
+	}
+}
+
+func TestEPDEscapedOperands(t *testing.T) {
+	b := ParseFen("8/8/4k3/8/8/2K5/8/8 b - - 0 1")
+	ops := map[string]string{"id": `say "hi"`, "c0": `a\b`}
+	written := WriteEPD(&b, ops)
+	expected := `8/8/4k3/8/8/2K5/8/8 b - - c0 "a\\b"; id "say \"hi\"";`
+	if written != expected {
+		t.Error("Wrong escaping in written EPD\nExpected", expected, "but got", written)
+	}
+	_, parsed, err := ParseEPD(written)
+	if err != nil {
+		t.Error("Failed to parse written EPD", written, ":", err)
+	}
+	for k, v := range ops {
+		if parsed[k] != v {
+			t.Error("Escaped operand", k, "did not round trip\nExpected", v, "but got", parsed[k])
+		}
+	}
+}
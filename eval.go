@@ -0,0 +1,476 @@
+package dragontoothmg
+
+// Helpers for writing evaluation functions. These compute common evaluation
+// terms from the board's bitboards, and are not used by the move generator.
+
+import (
+	"math/bits"
+)
+
+// Returns the pawns of the given color that share their file with another friendly pawn.
+func (b *Board) DoubledPawns(white bool) uint64 {
+	pawns := b.pawns(white)
+	var doubled uint64
+	for file := 0; file < 8; file++ {
+		onFile := pawns & onlyFile[file]
+		if bits.OnesCount64(onFile) > 1 {
+			doubled |= onFile
+		}
+	}
+	return doubled
+}
+
+// Returns the pawns of the given color that have no friendly pawns on adjacent files.
+func (b *Board) IsolatedPawns(white bool) uint64 {
+	pawns := b.pawns(white)
+	var isolated uint64
+	for file := 0; file < 8; file++ {
+		if pawns&adjacentFiles(file) == 0 {
+			isolated |= pawns & onlyFile[file]
+		}
+	}
+	return isolated
+}
+
+// Returns the pawns of the given color with no enemy pawns in front of them,
+// on either their own file or an adjacent file.
+func (b *Board) PassedPawns(white bool) uint64 {
+	pawns := b.pawns(white)
+	enemyPawns := b.pawns(!white)
+	var passed uint64
+	for candidates := pawns; candidates != 0; candidates &= candidates - 1 {
+		s := Square(bits.TrailingZeros64(candidates))
+		file := int(s) % 8
+		frontSpan := (onlyFile[file] | adjacentFiles(file)) & forwardRanks(s, white)
+		if enemyPawns&frontSpan == 0 {
+			passed |= uint64(1) << s
+		}
+	}
+	return passed
+}
+
+// A passed pawn, and how many squares it must advance to promote.
+type PassedPawn struct {
+	Square         Square
+	StepsToPromote int
+}
+
+// Returns each passed pawn of the given color (see PassedPawns()) with its distance
+// to the promotion rank, in order of square index. A pawn on its starting rank is
+// counted as six steps away, even though it may advance two squares at once.
+func (b *Board) PassedPawnAdvancement(white bool) []PassedPawn {
+	var advancement []PassedPawn
+	for x := b.PassedPawns(white); x != 0; x &= x - 1 {
+		s := Square(bits.TrailingZeros64(x))
+		steps := int(s) / 8
+		if white {
+			steps = 7 - steps
+		}
+		advancement = append(advancement, PassedPawn{s, steps})
+	}
+	return advancement
+}
+
+// Whether the legal move gives the side to move a passed pawn it did not have
+// before, such as a pawn capture that removes the last enemy pawn in front of it.
+// A passed pawn that merely advances is not counted as new.
+func (b *Board) MoveCreatesPassedPawn(m Move) bool {
+	mover := b.Wtomove
+	before := b.PassedPawns(mover)
+	if before&(uint64(1)<<m.From()) != 0 {
+		before |= uint64(1) << m.To()
+	}
+	unapply := b.Apply(m)
+	after := b.PassedPawns(mover)
+	unapply()
+	return after&^before != 0
+}
+
+// Returns the pawn bitboard for the given color.
+func (b *Board) pawns(white bool) uint64 {
+	if white {
+		return b.White.Pawns
+	}
+	return b.Black.Pawns
+}
+
+// Returns a mask of the files on either side of the given file (0-7).
+func adjacentFiles(file int) uint64 {
+	var mask uint64
+	if file > 0 {
+		mask |= onlyFile[file-1]
+	}
+	if file < 7 {
+		mask |= onlyFile[file+1]
+	}
+	return mask
+}
+
+// Returns a mask of all ranks strictly in front of the square, from the
+// perspective of the given color.
+func forwardRanks(s Square, white bool) uint64 {
+	rank := uint(s) / 8
+	if white {
+		if rank == 7 {
+			return 0
+		}
+		return ^((uint64(1) << ((rank + 1) * 8)) - 1)
+	}
+	return (uint64(1) << (rank * 8)) - 1
+}
+
+// How many ranks in front of the king are considered for the pawn shelter and
+// for enemy pawn storms.
+const (
+	kingShelterDepth = 2
+	pawnStormDepth   = 4
+)
+
+// Returns the friendly pawns sheltering the king: those on the king's file or an
+// adjacent file, within two ranks in front of the king.
+func (b *Board) KingShelter(white bool) uint64 {
+	return b.pawns(white) & kingFrontZone(b.kingSquare(white), white, kingShelterDepth)
+}
+
+// Returns the enemy pawns storming the king: those on the king's file or an
+// adjacent file, within four ranks in front of the king.
+func (b *Board) PawnStorm(white bool) uint64 {
+	return b.pawns(!white) & kingFrontZone(b.kingSquare(white), white, pawnStormDepth)
+}
+
+// Returns the square of the king of the given color. Assumes there is exactly one king.
+func (b *Board) kingSquare(white bool) Square {
+	if white {
+		return Square(bits.TrailingZeros64(b.White.Kings))
+	}
+	return Square(bits.TrailingZeros64(b.Black.Kings))
+}
+
+// Returns the squares on the king's file and adjacent files, up to depth ranks
+// in front of the king, from the perspective of the given color.
+func kingFrontZone(king Square, white bool, depth int) uint64 {
+	file := int(king) % 8
+	rank := int(king) / 8
+	var ranks uint64
+	for i := 1; i <= depth; i++ {
+		r := rank + i
+		if !white {
+			r = rank - i
+		}
+		if r < 0 || r > 7 {
+			break
+		}
+		ranks |= onlyRank[r]
+	}
+	return ranks & (onlyFile[file] | adjacentFiles(file))
+}
+
+// Weights of each piece type when attacking the enemy king zone, indexed by Piece.
+var kingZoneAttackWeights = [7]int{Nothing: 0, Pawn: 1, Knight: 2, Bishop: 2, Rook: 3, Queen: 5, King: 0}
+
+// Counts the enemy pieces attacking the zone around the king of the given color,
+// where the zone is the king's square and every square adjacent to it. Each
+// attacking piece is counted once, no matter how many zone squares it attacks.
+// Also returns the sum of the attackers' weights by piece type. The enemy king is
+// not counted as an attacker.
+func (b *Board) KingZoneAttackers(white bool) (count int, weight int) {
+	king := b.kingSquare(white)
+	zone := kingMasks[king] | (uint64(1) << king)
+	var attackers uint64
+	for zone != 0 {
+		s := Square(bits.TrailingZeros64(zone))
+		zone &= zone - 1
+		attackers |= b.AttackersTo(s, !white)
+	}
+	enemy := &(b.Black)
+	if !white {
+		enemy = &(b.White)
+	}
+	attackers &= ^enemy.Kings
+	count = bits.OnesCount64(attackers)
+	weight = bits.OnesCount64(attackers&enemy.Pawns)*kingZoneAttackWeights[Pawn] +
+		bits.OnesCount64(attackers&enemy.Knights)*kingZoneAttackWeights[Knight] +
+		bits.OnesCount64(attackers&enemy.Bishops)*kingZoneAttackWeights[Bishop] +
+		bits.OnesCount64(attackers&enemy.Rooks)*kingZoneAttackWeights[Rook] +
+		bits.OnesCount64(attackers&enemy.Queens)*kingZoneAttackWeights[Queen]
+	return count, weight
+}
+
+// Measures how close the given side's pieces are to the enemy king: each knight,
+// bishop, rook and queen adds 7 minus its king distance (see KingDistance()) from
+// the enemy king, so a piece next to the king adds 6 and one in the far corner
+// adds nothing. Pawns and the king are not counted.
+func (b *Board) KingTropism(white bool) int {
+	pieces := &(b.White)
+	if !white {
+		pieces = &(b.Black)
+	}
+	enemyKing := b.kingSquare(!white)
+	tropism := 0
+	for x := pieces.Knights | pieces.Bishops | pieces.Rooks | pieces.Queens; x != 0; x &= x - 1 {
+		tropism += 7 - KingDistance(Square(bits.TrailingZeros64(x)), enemyKing)
+	}
+	return tropism
+}
+
+// Values of each piece type in centipawns, indexed by Piece.
+var pieceValues = [7]int16{Nothing: 0, Pawn: 100, Knight: 300, Bishop: 300, Rook: 500, Queen: 900, King: 0}
+
+// Computes the material balance of the board in centipawns, from white's perspective:
+// pawns are worth 100, knights and bishops 300, rooks 500 and queens 900.
+func (b *Board) Material() int {
+	return bitboardsMaterial(&(b.White)) - bitboardsMaterial(&(b.Black))
+}
+
+// Returns the same value as Material(), in constant time. The value is maintained
+// incrementally by Apply(), for boards created by ParseFen() or ParseFenSafe().
+func (b *Board) CurrentMaterial() int {
+	return int(b.material)
+}
+
+// Sums the value of all the pieces on one side's bitboards.
+func bitboardsMaterial(bb *Bitboards) int {
+	return bits.OnesCount64(bb.Pawns)*int(pieceValues[Pawn]) +
+		bits.OnesCount64(bb.Knights)*int(pieceValues[Knight]) +
+		bits.OnesCount64(bb.Bishops)*int(pieceValues[Bishop]) +
+		bits.OnesCount64(bb.Rooks)*int(pieceValues[Rook]) +
+		bits.OnesCount64(bb.Queens)*int(pieceValues[Queen])
+}
+
+// Returns the pawns of the given color on their seventh rank (rank 7 for white,
+// rank 2 for black), one step from promoting. Whether the pawn is blocked or
+// pinned is not considered.
+func (b *Board) PawnsAboutToPromote(white bool) uint64 {
+	if white {
+		return b.White.Pawns & onlyRank[6]
+	}
+	return b.Black.Pawns & onlyRank[1]
+}
+
+// Calls fn once for every occupied square, with the piece on it and its color,
+// for example to sum piece-square table values. White's pieces are visited first.
+func (b *Board) ForEachPiece(fn func(s Square, p Piece, white bool)) {
+	forEachPieceOf(&(b.White), true, fn)
+	forEachPieceOf(&(b.Black), false, fn)
+}
+
+// Calls fn for every piece on one side's bitboards.
+func forEachPieceOf(bb *Bitboards, white bool, fn func(s Square, p Piece, white bool)) {
+	pieces := [...]struct {
+		piece    Piece
+		bitboard uint64
+	}{
+		{Pawn, bb.Pawns}, {Knight, bb.Knights}, {Bishop, bb.Bishops},
+		{Rook, bb.Rooks}, {Queen, bb.Queens}, {King, bb.Kings},
+	}
+	for _, p := range pieces {
+		for x := p.bitboard; x != 0; x &= x - 1 {
+			fn(Square(bits.TrailingZeros64(x)), p.piece, white)
+		}
+	}
+}
+
+// Whether the given color has at least two bishops.
+func (b *Board) HasBishopPair(white bool) bool {
+	if white {
+		return bits.OnesCount64(b.White.Bishops) >= 2
+	}
+	return bits.OnesCount64(b.Black.Bishops) >= 2
+}
+
+// Returns the number of knights and bishops of the given color.
+func (b *Board) MinorPieceCount(white bool) int {
+	if white {
+		return bits.OnesCount64(b.White.Knights | b.White.Bishops)
+	}
+	return bits.OnesCount64(b.Black.Knights | b.Black.Bishops)
+}
+
+// Weights of each piece type in the game phase, indexed by Piece. The starting
+// position has a total weight of maxPhaseWeight.
+var phaseWeights = [7]int{Nothing: 0, Pawn: 0, Knight: 1, Bishop: 1, Rook: 2, Queen: 4, King: 0}
+
+const (
+	maxPhaseWeight = 24
+	// The game phase of the starting position, as returned by GamePhase().
+	OpeningPhase = 256
+)
+
+// Returns the game phase for tapered evaluation, from 0 (only kings and pawns)
+// to OpeningPhase (all pieces on the board), based on the remaining knights,
+// bishops, rooks and queens of both sides. Extra pieces from promotion do not
+// raise the phase above OpeningPhase.
+func (b *Board) GamePhase() int {
+	weight := bits.OnesCount64(b.White.Knights|b.Black.Knights)*phaseWeights[Knight] +
+		bits.OnesCount64(b.White.Bishops|b.Black.Bishops)*phaseWeights[Bishop] +
+		bits.OnesCount64(b.White.Rooks|b.Black.Rooks)*phaseWeights[Rook] +
+		bits.OnesCount64(b.White.Queens|b.Black.Queens)*phaseWeights[Queen]
+	if weight > maxPhaseWeight {
+		weight = maxPhaseWeight
+	}
+	return (weight*OpeningPhase + maxPhaseWeight/2) / maxPhaseWeight
+}
+
+// Whether the given color has any knights, bishops, rooks or queens. Null-move
+// pruning is usually disabled for a side with only a king and pawns, where
+// zugzwang is common.
+func (b *Board) HasNonPawnMaterial(white bool) bool {
+	pieces := &(b.White)
+	if !white {
+		pieces = &(b.Black)
+	}
+	return pieces.Knights|pieces.Bishops|pieces.Rooks|pieces.Queens != 0
+}
+
+// Returns every square attacked by the pawns of the given color, whether or not
+// an enemy piece stands there, for outpost and space evaluation terms.
+func (b *Board) PawnAttackSpan(white bool) uint64 {
+	east, west := pawnAttackBitboards(b.pawns(white), white)
+	return east | west
+}
+
+// Returns the knights of the given color on outposts: squares defended by a
+// friendly pawn that no enemy pawn attacks now or can ever attack by advancing,
+// because no enemy pawn stands ahead of the square on an adjacent file.
+func (b *Board) KnightOutposts(white bool) uint64 {
+	enemyPawns := b.pawns(!white)
+	var outposts uint64
+	for x := b.Pieces(Knight, white) & b.PawnAttackSpan(white); x != 0; x &= x - 1 {
+		s := Square(bits.TrailingZeros64(x))
+		if enemyPawns&adjacentFiles(int(s)%8)&forwardRanks(s, white) == 0 {
+			outposts |= uint64(1) << s
+		}
+	}
+	return outposts
+}
+
+// The four central squares: d4, e4, d5 and e5.
+const centerSquares uint64 = (uint64(1) << 27) | (uint64(1) << 28) | (uint64(1) << 35) | (uint64(1) << 36)
+
+// Returns how many of the four central squares (d4, e4, d5 and e5) are attacked
+// by at least one piece of the given color. Squares holding the side's own pieces
+// count if they are defended.
+func (b *Board) CenterControl(white bool) int {
+	count := 0
+	for x := centerSquares; x != 0; x &= x - 1 {
+		if b.AttackersTo(Square(bits.TrailingZeros64(x)), white) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Whether the king of the given color is on its back rank with every square in
+// front of it (on its own file and the adjacent files) held by a friendly pawn,
+// so that it has no luft and may be mated by a rook or queen on the back rank.
+func (b *Board) BackRankWeakness(white bool) bool {
+	king := b.kingSquare(white)
+	backRank := 0
+	if !white {
+		backRank = 7
+	}
+	if int(king)/8 != backRank {
+		return false
+	}
+	front := kingFrontZone(king, white, 1)
+	return b.pawns(white)&front == front
+}
+
+// Whether the given color holds the opposition: the kings stand on the same file,
+// rank or diagonal with one square between them, and it is the other side's turn
+// to move. Distant opposition, with more squares between the kings, is not
+// considered.
+func (b *Board) HasOpposition(white bool) bool {
+	if b.Wtomove == white {
+		return false
+	}
+	fileDistance, rankDistance := squareOffsets(b.kingSquare(true), b.kingSquare(false))
+	return (fileDistance == 0 || fileDistance == 2) && (rankDistance == 0 || rankDistance == 2) &&
+		fileDistance+rankDistance != 0
+}
+
+// Whether the king of the given color has luft: an empty square in front of it,
+// on its own file or an adjacent file, that the enemy does not attack.
+func (b *Board) KingHasLuft(white bool) bool {
+	front := kingFrontZone(b.kingSquare(white), white, 1)
+	return b.KingSafeSquares(white)&front&^(b.White.All|b.Black.All) != 0
+}
+
+// Returns the rooks of the given color on open files: files with no pawns at all.
+func (b *Board) RooksOnOpenFiles(white bool) uint64 {
+	return b.Pieces(Rook, white) & filesWithout(b.White.Pawns|b.Black.Pawns)
+}
+
+// Returns the rooks of the given color on semi-open files: files with no friendly
+// pawns. Open files count as semi-open too, so these include RooksOnOpenFiles().
+func (b *Board) RooksOnSemiOpenFiles(white bool) uint64 {
+	return b.Pieces(Rook, white) & filesWithout(b.pawns(white))
+}
+
+// Returns the union of the files that contain none of the given squares.
+func filesWithout(squares uint64) uint64 {
+	var files uint64
+	for file := 0; file < 8; file++ {
+		if squares&onlyFile[file] == 0 {
+			files |= onlyFile[file]
+		}
+	}
+	return files
+}
+
+// Whether two of the given side's rooks stand on its back rank with nothing
+// between them, so that they defend each other: the usual sign that the side has
+// finished developing its minor pieces and castled.
+func (b *Board) RooksConnected(white bool) bool {
+	backRank := onlyRank[0]
+	if !white {
+		backRank = onlyRank[7]
+	}
+	rooks := b.Pieces(Rook, white) & backRank
+	occupied := b.White.All | b.Black.All
+	for x := rooks; x != 0; x &= x - 1 {
+		if CalculateRookMoveBitboard(uint8(bits.TrailingZeros64(x)), occupied)&rooks != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether each side has exactly one bishop, and the two stand on squares of
+// opposite colors, a strong sign of a drawish endgame.
+func (b *Board) OppositeColoredBishops() bool {
+	if bits.OnesCount64(b.White.Bishops) != 1 || bits.OnesCount64(b.Black.Bishops) != 1 {
+		return false
+	}
+	return (b.White.Bishops&lightSquares == 0) != (b.Black.Bishops&lightSquares == 0)
+}
+
+// Returns a hash of the number of pawns, knights, bishops, rooks and queens of each
+// color, ignoring where they stand, for keying material-indexed caches such as
+// imbalance tables. Positions with the same material always share the hash, and
+// positions with different material (up to 15 of a piece type) never do.
+func (b *Board) MaterialHash() uint64 {
+	var key uint64
+	for _, bb := range [2]*Bitboards{&(b.White), &(b.Black)} {
+		for _, pieces := range [...]uint64{bb.Pawns, bb.Knights, bb.Bishops, bb.Rooks, bb.Queens} {
+			key = key<<4 | uint64(bits.OnesCount64(pieces))
+		}
+	}
+	// multiplying by an odd constant spreads the counts over all of the bits,
+	// without introducing collisions
+	return key * 0x9E3779B97F4A7C15
+}
+
+// Returns the pawns of the given color that stand beside another friendly pawn, on
+// the same rank and an adjacent file.
+func (b *Board) PhalanxPawns(white bool) uint64 {
+	pawns := b.pawns(white)
+	beside := ((pawns << 1) & ^onlyFile[0]) | ((pawns >> 1) & ^onlyFile[7])
+	return pawns & beside
+}
+
+// Returns the connected pawns of the given color: those defended by a friendly
+// pawn, and those in a phalanx (see PhalanxPawns()).
+func (b *Board) ConnectedPawns(white bool) uint64 {
+	return b.pawns(white)&b.PawnAttackSpan(white) | b.PhalanxPawns(white)
+}
@@ -0,0 +1,553 @@
+package dragontoothmg
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// Builds a bitboard from a list of algebraic squares.
+func bitboardOf(squares ...string) uint64 {
+	var bb uint64
+	for _, s := range squares {
+		bb |= uint64(1) << algebraicToIndexFatal(s)
+	}
+	return bb
+}
+
+func TestPawnStructure(t *testing.T) {
+	b := ParseFen("4k3/2p3p1/8/4P2P/3P4/P7/P7/4K3 w - - 0 1")
+	if res := b.DoubledPawns(true); res != bitboardOf("a2", "a3") {
+		t.Error("Wrong doubled pawns for white:", res)
+	}
+	if res := b.DoubledPawns(false); res != 0 {
+		t.Error("Wrong doubled pawns for black:", res)
+	}
+	if res := b.IsolatedPawns(true); res != bitboardOf("a2", "a3", "h5") {
+		t.Error("Wrong isolated pawns for white:", res)
+	}
+	if res := b.IsolatedPawns(false); res != bitboardOf("c7", "g7") {
+		t.Error("Wrong isolated pawns for black:", res)
+	}
+	if res := b.PassedPawns(true); res != bitboardOf("a2", "a3", "e5") {
+		t.Error("Wrong passed pawns for white:", res)
+	}
+	if res := b.PassedPawns(false); res != 0 {
+		t.Error("Wrong passed pawns for black:", res)
+	}
+	b2 := ParseFen("4k3/8/8/8/8/8/p6P/4K3 w - - 0 1")
+	if res := b2.PassedPawns(false); res != bitboardOf("a2") {
+		t.Error("Wrong passed pawns for black:", res)
+	}
+	if res := b2.PassedPawns(true); res != bitboardOf("h2") {
+		t.Error("Wrong passed pawns for white:", res)
+	}
+}
+
+func TestPassedPawnAdvancement(t *testing.T) {
+	// the c2 and d3 pawns block each other, so neither is passed
+	b := ParseFen("4k3/1P6/8/4P3/8/3p4/p1P4P/4K3 w - - 0 1")
+	positions := []struct {
+		white    bool
+		expected []PassedPawn
+	}{
+		{true, []PassedPawn{{Square(algebraicToIndexFatal("h2")), 6}, {Square(algebraicToIndexFatal("e5")), 3},
+			{Square(algebraicToIndexFatal("b7")), 1}}},
+		{false, []PassedPawn{{Square(algebraicToIndexFatal("a2")), 1}}},
+	}
+	for _, p := range positions {
+		advancement := b.PassedPawnAdvancement(p.white)
+		if len(advancement) != len(p.expected) {
+			t.Error("Wrong passed pawns, white:", p.white, "\nExpected", p.expected, "but got", advancement)
+			continue
+		}
+		for i := range advancement {
+			if advancement[i] != p.expected[i] {
+				t.Error("Wrong passed pawn advancement, white:", p.white, "\nExpected", p.expected, "but got", advancement)
+				break
+			}
+		}
+	}
+	start := ParseFen(Startpos)
+	if advancement := start.PassedPawnAdvancement(true); len(advancement) != 0 {
+		t.Error("No pawn is passed in the starting position.")
+	}
+}
+
+func TestMoveCreatesPassedPawn(t *testing.T) {
+	positions := []struct {
+		fen      string
+		move     string
+		expected bool
+	}{
+		// the capture removes the pawn that stopped both white pawns
+		{"4k3/8/8/3p4/2P1P3/8/8/4K3 w - - 0 1", "c4d5", true},
+		{"4k3/8/8/2p1p3/3P4/8/8/4K3 b - - 0 1", "e5d4", true},
+		// a piece capture can remove the blocker, too
+		{"4k3/8/3p4/8/1B1P4/8/8/4K3 w - - 0 1", "b4d6", true},
+		{"4k3/8/8/3p4/2P1P3/8/8/4K3 w - - 0 1", "e1e2", false},
+		// a passed pawn that advances is still the same passed pawn
+		{"4k3/8/8/8/P7/8/8/4K3 w - - 0 1", "a4a5", false},
+		{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8q", false},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if created := b.MoveCreatesPassedPawn(parseMove(p.move)); created != p.expected {
+			t.Error("Wrong passed pawn creation for", p.move, "in", p.fen, "\nExpected", p.expected, "but got", created)
+		}
+		if fen := b.ToFen(); fen != p.fen {
+			t.Error("MoveCreatesPassedPawn changed the board\nExpected", p.fen, "but got", fen)
+		}
+	}
+}
+
+func TestKingShelterAndStorm(t *testing.T) {
+	// castled king with an intact shelter, and no storm
+	b := ParseFen("r4rk1/pppq1ppp/2n5/8/8/2N5/PPPQ1PPP/R4RK1 w - - 0 1")
+	if res := b.KingShelter(true); res != bitboardOf("f2", "g2", "h2") {
+		t.Error("Wrong king shelter for white:", res)
+	}
+	if res := b.KingShelter(false); res != bitboardOf("f7", "g7", "h7") {
+		t.Error("Wrong king shelter for black:", res)
+	}
+	if res := b.PawnStorm(true); res != 0 {
+		t.Error("Wrong pawn storm against white:", res)
+	}
+	// black pawns advancing on the white king, which has a weakened shelter
+	b2 := ParseFen("r4rk1/ppp2p2/2n5/6pp/7P/2N3P1/PPP2P2/R4RK1 w - - 0 1")
+	if res := b2.KingShelter(true); res != bitboardOf("f2", "g3") {
+		t.Error("Wrong king shelter for white:", res)
+	}
+	if res := b2.PawnStorm(true); res != bitboardOf("g5", "h5") {
+		t.Error("Wrong pawn storm against white:", res)
+	}
+	if res := b2.PawnStorm(false); res != bitboardOf("h4") {
+		t.Error("Wrong pawn storm against black:", res)
+	}
+}
+
+func TestKingZoneAttackers(t *testing.T) {
+	// The white king on g1 is attacked by the h3 queen, the g4 knight and the d6 bishop
+	// (through h2). The rook on a8 and the black king do not reach the zone.
+	b := ParseFen("r5k1/ppp2ppp/3b4/8/6n1/7q/PPP2P2/R4RK1 w - - 0 1")
+	count, weight := b.KingZoneAttackers(true)
+	if count != 3 || weight != 9 {
+		t.Error("Wrong king zone attackers for exposed king. Expected 3, 9 but got", count, weight)
+	}
+	// The black king is safe.
+	count, weight = b.KingZoneAttackers(false)
+	if count != 0 || weight != 0 {
+		t.Error("Wrong king zone attackers for safe king. Expected 0, 0 but got", count, weight)
+	}
+}
+
+func TestPawnsAboutToPromote(t *testing.T) {
+	b := ParseFen("n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1")
+	if res := b.PawnsAboutToPromote(true); res != bitboardOf("a7", "b7", "c7") {
+		t.Error("Wrong promoting pawns for white:", res)
+	}
+	if res := b.PawnsAboutToPromote(false); res != bitboardOf("f2", "g2", "h2") {
+		t.Error("Wrong promoting pawns for black:", res)
+	}
+	// pawns on their own starting rank are not about to promote
+	start := ParseFen(Startpos)
+	if start.PawnsAboutToPromote(true) != 0 || start.PawnsAboutToPromote(false) != 0 {
+		t.Error("Pawns on their starting ranks were reported as about to promote.")
+	}
+}
+
+func TestKingTropism(t *testing.T) {
+	positions := []struct {
+		fen      string
+		white    bool
+		expected int
+	}{
+		// the queen and knight are three squares away and the bishop five
+		{"6k1/5ppp/8/5N1Q/8/3B4/8/4K3 w - - 0 1", true, 10},
+		// the same pieces, waiting in the far corner
+		{"6k1/5ppp/8/8/8/8/8/QNB1K3 w - - 0 1", true, 0},
+		{"6k1/5ppp/8/5N1Q/8/3B4/8/4K3 w - - 0 1", false, 0},
+		{"4k3/8/8/8/8/8/3q4/4K3 b - - 0 1", false, 6},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if tropism := b.KingTropism(p.white); tropism != p.expected {
+			t.Error("Wrong king tropism for", p.fen, "white:", p.white, "\nExpected", p.expected, "but got", tropism)
+		}
+	}
+}
+
+func TestForEachPiece(t *testing.T) {
+	// a toy piece-square table: the piece value plus the square index, mirrored for black
+	pst := func(s Square, p Piece, white bool) int {
+		if !white {
+			s ^= 56
+		}
+		return int(pieceValues[p]) + int(s)
+	}
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/8/4k3/8/8/2K5/8/8 w - - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		visited := make(map[Square]bool)
+		sum := 0
+		b.ForEachPiece(func(s Square, p Piece, white bool) {
+			if visited[s] {
+				t.Error("Visited square", s, "more than once for", fen)
+			}
+			visited[s] = true
+			if white {
+				sum += pst(s, p, white)
+			} else {
+				sum -= pst(s, p, white)
+			}
+		})
+		expected := 0
+		for s := Square(0); s < 64; s++ {
+			p, white := b.pieceAt(s)
+			if p == Nothing {
+				continue
+			}
+			if white {
+				expected += pst(s, p, white)
+			} else {
+				expected -= pst(s, p, white)
+			}
+		}
+		if sum != expected {
+			t.Error("Wrong piece-square sum for", fen, "\nExpected", expected, "but got", sum)
+		}
+		if len(visited) != bits.OnesCount64(b.White.All|b.Black.All) {
+			t.Error("Wrong number of squares visited for", fen, ":", len(visited))
+		}
+	}
+	// the mirrored table cancels out in a symmetric position
+	b := ParseFen(Startpos)
+	total := 0
+	b.ForEachPiece(func(s Square, p Piece, white bool) {
+		if white {
+			total += pst(s, p, white)
+		} else {
+			total -= pst(s, p, white)
+		}
+	})
+	if total != 0 {
+		t.Error("Mirrored piece-square sum of the starting position should be 0 but got", total)
+	}
+}
+
+func TestBishopPairAndMinorPieces(t *testing.T) {
+	type expectation struct {
+		whitePair, blackPair   bool
+		whiteMinor, blackMinor int
+	}
+	positions := map[string]expectation{
+		Startpos:                                {true, true, 4, 4},
+		"4k3/8/2b5/8/8/2BB4/8/4K3 w - - 0 1":    {true, false, 2, 1},
+		"4k3/2n5/2b5/8/8/2B5/5N2/4K3 w - - 0 1": {false, false, 2, 2},
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1":         {false, false, 0, 0},
+		"2b1kb2/8/8/8/8/8/8/4K1N1 w - - 0 1":    {false, true, 1, 2},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		got := expectation{b.HasBishopPair(true), b.HasBishopPair(false),
+			b.MinorPieceCount(true), b.MinorPieceCount(false)}
+		if got != v {
+			t.Error("Wrong bishop pair or minor piece count for", k, "\nExpected", v, "but got", got)
+		}
+	}
+}
+
+func TestGamePhase(t *testing.T) {
+	positions := map[string]int{
+		Startpos: OpeningPhase,
+		// bare kings, and kings with pawns
+		"8/8/4k3/8/8/2K5/8/8 w - - 0 1":                            0,
+		"8/pp6/4k3/8/8/2K5/6PP/8 w - - 0 1":                        0,
+		"8/8/3rk3/8/8/2KQ4/8/8 w - - 0 1":                          64,
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1":                     85,
+		"4k3/QQQQQQQQ/8/8/8/8/8/4K3 w - - 0 1":                     OpeningPhase,
+		"rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNB1KBNR w KQkq - 0 1": 171,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if phase := b.GamePhase(); phase != v {
+			t.Error("Wrong game phase for", k, "\nExpected", v, "but got", phase)
+		}
+	}
+}
+
+func TestHasNonPawnMaterial(t *testing.T) {
+	positions := map[string][2]bool{
+		Startpos:                              {true, true},
+		"8/pp6/4k3/8/8/2K5/6PP/8 w - - 0 1":   {false, false},
+		"8/pp6/4k3/8/8/2K5/6PP/4N3 w - - 0 1": {true, false},
+		"8/8/3rk3/8/8/2K5/8/8 b - - 0 1":      {false, true},
+		"8/8/4k3/8/8/2K5/8/8 w - - 0 1":       {false, false},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if b.HasNonPawnMaterial(true) != v[0] || b.HasNonPawnMaterial(false) != v[1] {
+			t.Error("Wrong non-pawn material for", k, "\nExpected", v)
+		}
+	}
+}
+
+func TestPawnAttackSpan(t *testing.T) {
+	// a white pawn chain from b2 to e5, and black pawns on the edge files
+	b := ParseFen("4k3/p7/8/4P3/3P3p/2P5/1P6/4K3 w - - 0 1")
+	if span := b.PawnAttackSpan(true); span != bitboardOf("a3", "c3", "b4", "d4", "c5", "e5", "d6", "f6") {
+		t.Error("Wrong white pawn attack span:", span)
+	}
+	// attacks on the a and h files must not wrap around the board
+	if span := b.PawnAttackSpan(false); span != bitboardOf("b6", "g3") {
+		t.Error("Wrong black pawn attack span:", span)
+	}
+	edges := ParseFen("4k3/8/8/7P/P7/8/8/4K3 w - - 0 1")
+	if span := edges.PawnAttackSpan(true); span != bitboardOf("b5", "g6") {
+		t.Error("White pawn attacks wrapped around the board edge:", span)
+	}
+}
+
+func TestKnightOutposts(t *testing.T) {
+	positions := []struct {
+		fen      string
+		white    bool
+		expected uint64
+	}{
+		// the b3 knight is defended, but the a-pawn can still drive it away
+		{"4k3/pp4pp/8/3N4/4P3/1N6/P7/4K3 w - - 0 1", true, bitboardOf("d5")},
+		{"4k3/2p3pp/8/3N4/4P3/8/8/4K3 w - - 0 1", true, 0},
+		// the c5 pawn has already passed the knight
+		{"4k3/6pp/8/2pN4/4P3/8/8/4K3 w - - 0 1", true, bitboardOf("d5")},
+		// an undefended knight is not on an outpost
+		{"4k3/6pp/8/3N4/8/8/8/4K3 w - - 0 1", true, 0},
+		{"4k3/8/8/3p4/4n3/8/PP4PP/4K3 b - - 0 1", false, bitboardOf("e4")},
+		{"4k3/8/8/3p4/4n3/8/PP3PPP/4K3 b - - 0 1", false, 0},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if outposts := b.KnightOutposts(p.white); outposts != p.expected {
+			t.Error("Wrong knight outposts for", p.fen, "white:", p.white, "\nExpected", p.expected, "but got", outposts)
+		}
+	}
+}
+
+func TestCenterControl(t *testing.T) {
+	positions := map[string][2]int{
+		Startpos: {0, 0},
+		// a classical pawn center
+		"rnbqkbnr/ppp2ppp/3p4/4p3/3PP3/5N2/PPP2PPP/RNBQKB1R b KQkq - 1 3": {3, 2},
+		// black controls the center from a distance, with the f6 knight
+		"rnbqkb1r/pppppp1p/5np1/8/2PP4/2N5/PP2PPPP/R1BQKBNR b KQkq - 1 3": {4, 2},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if white, black := b.CenterControl(true), b.CenterControl(false); white != v[0] || black != v[1] {
+			t.Error("Wrong center control for", k, "\nExpected", v, "but got", white, black)
+		}
+	}
+	if centerSquares != bitboardOf("d4", "e4", "d5", "e5") {
+		t.Error("Wrong center squares mask.")
+	}
+}
+
+func TestBackRankWeakness(t *testing.T) {
+	positions := []struct {
+		fen      string
+		white    bool
+		expected bool
+	}{
+		{"6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", true, true},
+		{"6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", false, true},
+		// h3 and g6 give the kings luft
+		{"6k1/5p1p/6p1/8/8/7P/5PP1/6K1 w - - 0 1", true, false},
+		{"6k1/5p1p/6p1/8/8/7P/5PP1/6K1 w - - 0 1", false, false},
+		// a king in the corner needs only two pawns to be boxed in
+		{"7k/6pp/8/8/8/8/6PP/7K w - - 0 1", true, true},
+		// the king is not on its back rank
+		{"8/5ppp/6k1/8/8/6K1/5PPP/8 w - - 0 1", true, false},
+		{Startpos, true, true},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if result := b.BackRankWeakness(p.white); result != p.expected {
+			t.Error("Wrong back rank weakness for", p.fen, "white:", p.white, "\nExpected", p.expected)
+		}
+	}
+}
+
+func TestHasOpposition(t *testing.T) {
+	positions := map[string][2]bool{
+		"8/8/4k3/8/4K3/8/8/8 b - - 0 1": {true, false},  // direct opposition on a file
+		"8/8/4k3/8/4K3/8/8/8 w - - 0 1": {false, true},  // the same, with white to move
+		"8/8/8/2k1K3/8/8/8/8 w - - 0 1": {false, true},  // direct opposition on a rank
+		"8/8/2k5/8/4K3/8/8/8 b - - 0 1": {true, false},  // diagonal opposition
+		"8/4k3/8/8/4K3/8/8/8 b - - 0 1": {false, false}, // distant opposition
+		"8/8/3k4/8/4K3/8/8/8 b - - 0 1": {false, false}, // a knight's move apart
+		"8/8/8/4k3/4K3/8/8/8 b - - 0 1": {false, false}, // adjacent
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if white, black := b.HasOpposition(true), b.HasOpposition(false); white != v[0] || black != v[1] {
+			t.Error("Wrong opposition for", k, "\nExpected", v, "but got", white, black)
+		}
+	}
+}
+
+func TestKingHasLuft(t *testing.T) {
+	positions := []struct {
+		fen      string
+		white    bool
+		expected bool
+	}{
+		{"6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", true, false},
+		{"6k1/5ppp/8/8/8/7P/5PP1/6K1 w - - 0 1", true, true},
+		{"6k1/5pp1/7p/8/8/8/5PPP/6K1 w - - 0 1", false, true},
+		// the bishop covers h2
+		{"6k1/2b2ppp/8/8/8/7P/5PP1/6K1 w - - 0 1", true, false},
+		// an enemy piece is not an escape square, even if it can be captured
+		{"6k1/5ppp/8/8/8/7P/5PPn/6K1 w - - 0 1", true, false},
+		{Startpos, true, false},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if result := b.KingHasLuft(p.white); result != p.expected {
+			t.Error("Wrong luft for", p.fen, "white:", p.white, "\nExpected", p.expected)
+		}
+	}
+}
+
+func TestRooksOnOpenFiles(t *testing.T) {
+	// the a-file is open, the d-file is semi-open for white and the h-file is closed
+	b := ParseFen("r2rk2r/1pp2pp1/8/3p3p/8/8/1PP2PPP/R2RK2R w - - 0 1")
+	positions := []struct {
+		white    bool
+		open     uint64
+		semiOpen uint64
+	}{
+		// the open a-file is semi-open as well
+		{true, bitboardOf("a1"), bitboardOf("a1", "d1")},
+		{false, bitboardOf("a8"), bitboardOf("a8")},
+	}
+	for _, p := range positions {
+		if open := b.RooksOnOpenFiles(p.white); open != p.open {
+			t.Error("Wrong rooks on open files, white:", p.white, "\nExpected", p.open, "but got", open)
+		}
+		if semiOpen := b.RooksOnSemiOpenFiles(p.white); semiOpen != p.semiOpen {
+			t.Error("Wrong rooks on semi-open files, white:", p.white, "\nExpected", p.semiOpen, "but got", semiOpen)
+		}
+	}
+	start := ParseFen(Startpos)
+	if start.RooksOnOpenFiles(true)|start.RooksOnSemiOpenFiles(true) != 0 {
+		t.Error("No rook is on an open file in the starting position.")
+	}
+}
+
+func TestRooksConnected(t *testing.T) {
+	positions := []struct {
+		fen       string
+		white     bool
+		connected bool
+	}{
+		{Startpos, true, false},
+		{Startpos, false, false},
+		// both sides castled short with the queens and minor pieces developed
+		{"r4rk1/pp1qbppp/2n1pn2/3p4/3P4/2N1PN2/PP1QBPPP/R4RK1 w - - 0 10", true, true},
+		{"r4rk1/pp1qbppp/2n1pn2/3p4/3P4/2N1PN2/PP1QBPPP/R4RK1 w - - 0 10", false, true},
+		// the queen still stands between the rooks
+		{"r2q1rk1/pp2bppp/2n1pn2/3p4/3P4/2N1PN2/PP2BPPP/R2Q1RK1 w - - 0 9", true, false},
+		// a rook that has left the back rank does not count
+		{"4k3/8/8/8/8/8/R7/4K2R w - - 0 1", true, false},
+		{"r6r/4k3/8/8/8/8/8/4K3 b - - 0 1", false, true},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if connected := b.RooksConnected(p.white); connected != p.connected {
+			t.Error("Wrong rook connection for", p.fen, "white:", p.white, "\nExpected", p.connected, "but got", connected)
+		}
+	}
+}
+
+func TestOppositeColoredBishops(t *testing.T) {
+	positions := map[string]bool{
+		Startpos: false,
+		// c1 is dark and c8 is light
+		"2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1":     true,
+		"2b1k3/1p6/8/8/8/8/5PP1/4KB2 w - - 0 1": false,
+		"2b1k3/8/8/8/8/8/8/1B2K3 w - - 0 1":     false,
+		"2b1k3/8/8/8/8/8/8/4K3 w - - 0 1":       false,
+		"2b1k3/8/8/8/8/8/8/1BB1K3 w - - 0 1":    false,
+		"2b1k3/8/8/8/8/8/3N4/2B1K3 w - - 0 1":   true,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		if res := b.OppositeColoredBishops(); res != v {
+			t.Error("Wrong opposite-colored bishops result for", k, "\nExpected", v, "but got", res)
+		}
+	}
+}
+
+func TestMaterialHash(t *testing.T) {
+	same := []string{
+		"4k3/8/8/3p4/8/2N5/PP6/4K2R w - - 0 1",
+		"4k3/1p6/8/8/3N4/8/6PP/K6R b - - 0 1",
+		"4k3/8/3p4/8/1N6/8/P1P5/3RK3 w - - 0 1",
+	}
+	different := []string{
+		Startpos,
+		// black's pawn becomes white's
+		"4k3/8/8/8/8/2N5/PP1P4/4K2R w - - 0 1",
+		// a knight becomes a bishop
+		"4k3/8/8/3p4/8/2B5/PP6/4K2R w - - 0 1",
+		// the same pieces, with the colors swapped
+		"4K3/8/8/3P4/8/2n5/pp6/4k2r w - - 0 1",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+	}
+	first := ParseFen(same[0])
+	hash := first.MaterialHash()
+	for _, fen := range same {
+		b := ParseFen(fen)
+		if b.MaterialHash() != hash {
+			t.Error("Positions with the same material have different hashes:", fen)
+		}
+	}
+	seen := map[uint64]string{hash: same[0]}
+	for _, fen := range different {
+		b := ParseFen(fen)
+		if other, ok := seen[b.MaterialHash()]; ok {
+			t.Error("Positions with different material share a hash:", fen, "and", other)
+		}
+		seen[b.MaterialHash()] = fen
+	}
+}
+
+func TestConnectedPawns(t *testing.T) {
+	positions := []struct {
+		fen       string
+		white     bool
+		connected uint64
+		phalanx   uint64
+	}{
+		// a pawn chain: each pawn after the first is defended
+		{"4k3/8/8/4P3/3P4/2P5/8/4K3 w - - 0 1", true, bitboardOf("d4", "e5"), 0},
+		// a phalanx, and an isolated pawn
+		{"4k3/8/8/8/2PP3P/8/8/4K3 w - - 0 1", true, bitboardOf("c4", "d4"), bitboardOf("c4", "d4")},
+		// the a and h files do not wrap around to each other
+		{"4k3/p6p/8/8/P6P/7p/8/4K3 b - - 0 1", false, 0, 0},
+		{"4k3/8/8/8/P6P/p6p/8/4K3 w - - 0 1", true, 0, 0},
+		{"4k3/p6p/6p1/8/8/8/8/4K3 b - - 0 1", false, bitboardOf("g6"), 0},
+		{Startpos, true, onlyRank[1], onlyRank[1]},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		if connected := b.ConnectedPawns(p.white); connected != p.connected {
+			t.Error("Wrong connected pawns for", p.fen, "\nExpected", p.connected, "but got", connected)
+		}
+		if phalanx := b.PhalanxPawns(p.white); phalanx != p.phalanx {
+			t.Error("Wrong phalanx pawns for", p.fen, "\nExpected", p.phalanx, "but got", phalanx)
+		}
+	}
+}
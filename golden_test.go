@@ -0,0 +1,83 @@
+package dragontoothmg
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Checks that the legal moves generated for a position are exactly the expected
+// moves, given as UCI strings in any order.
+func CompareAgainstGolden(t *testing.T, fen string, expectedUCI []string) {
+	actual, err := GoldenMoves(fen)
+	if err != nil {
+		t.Error("Failed to generate moves for", fen, ":", err)
+		return
+	}
+	expected := make([]Move, 0, len(expectedUCI))
+	for _, s := range expectedUCI {
+		m, err := ParseMove(s)
+		if err != nil {
+			t.Error("Invalid golden move", s, "for", fen)
+			return
+		}
+		expected = append(expected, m)
+	}
+	SortMoves(expected)
+	if len(actual) != len(expected) {
+		t.Error("Wrong number of moves for", fen, "\nExpected", expectedUCI, "but got", actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i].String() {
+			t.Error("Moves differ from golden file for", fen, "\nExpected", expectedUCI, "but got", actual)
+			return
+		}
+	}
+}
+
+func TestGoldenFiles(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden_*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("No golden files found:", err)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.SplitN(line, ";", 2)
+			if len(fields) != 2 {
+				t.Error("Malformed line in", name, ":", line)
+				continue
+			}
+			CompareAgainstGolden(t, strings.TrimSpace(fields[0]), strings.Fields(fields[1]))
+		}
+		if err := scanner.Err(); err != nil {
+			t.Error("Failed to read", name, ":", err)
+		}
+		f.Close()
+	}
+}
+
+func TestSortMoves(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	moves := b.GenerateLegalMoves()
+	SortMoves(moves)
+	for i := 1; i < len(moves); i++ {
+		if moves[i-1].String() >= moves[i].String() {
+			t.Error("Moves are not sorted:", &moves[i-1], &moves[i])
+		}
+	}
+	if _, err := GoldenMoves("not a fen"); err == nil {
+		t.Error("Generated golden moves for an invalid FEN.")
+	}
+}
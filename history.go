@@ -0,0 +1,175 @@
+package dragontoothmg
+
+// Game history tracking, for detecting draws by repetition and by the move clocks.
+
+// The result of a game, or the reason that a draw can be claimed or is automatic.
+type GameResult int
+
+const (
+	NoResult GameResult = iota
+	WhiteWins
+	BlackWins
+	Stalemate
+	InsufficientMaterial
+	ThreefoldRepetition
+	FivefoldRepetition
+	FiftyMoveRule
+	SeventyFiveMoveRule
+)
+
+// A game in progress: the current board, along with the hashes of every earlier
+// position, so that repetitions can be detected.
+type History struct {
+	Board  Board
+	hashes []uint64 // hashes of all previous positions, oldest first
+}
+
+// Begins a game history at the given position.
+func NewHistory(b Board) *History {
+	return &History{Board: b}
+}
+
+// Applies a move to the current board, recording the position it leaves.
+// Like Board.Apply(), this assumes the move is legal.
+func (h *History) Apply(m Move) {
+	h.hashes = append(h.hashes, h.Board.Hash())
+	h.Board.Apply(m)
+}
+
+// Returns how many times the current position has occurred in the game,
+// including the current occurrence. Positions are compared by their hashes.
+func (h *History) Repetitions() int {
+	count := 1
+	current := h.Board.Hash()
+	// No position before the last capture or pawn move can repeat.
+	for i := len(h.hashes) - 1; i >= 0 && i >= len(h.hashes)-int(h.Board.Halfmoveclock); i-- {
+		if h.hashes[i] == current {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns the draws that the side to move may claim under the FIDE rules:
+// threefold repetition, and the fifty-move rule.
+func (h *History) ClaimableDraws() []GameResult {
+	var claims []GameResult
+	if h.Board.IsCheckmate() {
+		return claims
+	}
+	if h.Repetitions() >= 3 {
+		claims = append(claims, ThreefoldRepetition)
+	}
+	if h.Board.Halfmoveclock >= fiftyMoveRuleHalfmoves {
+		claims = append(claims, FiftyMoveRule)
+	}
+	return claims
+}
+
+// The halfmove clock value at which a draw can be claimed under the fifty-move rule.
+const fiftyMoveRuleHalfmoves = 100
+
+// Returns how many more halfmoves without a capture or pawn move are needed before
+// a draw can be claimed under the fifty-move rule, or 0 if it can be claimed now.
+func (b *Board) HalfmovesUntilFiftyMoveDraw() int {
+	if b.Halfmoveclock >= fiftyMoveRuleHalfmoves {
+		return 0
+	}
+	return fiftyMoveRuleHalfmoves - int(b.Halfmoveclock)
+}
+
+// Returns whether the game is automatically drawn under the FIDE rules, and why:
+// stalemate, insufficient material, fivefold repetition, or the seventy-five-move rule.
+// A checkmate takes precedence over every automatic draw.
+func (h *History) AutomaticDraw() (GameResult, bool) {
+	if h.Board.IsCheckmate() {
+		return NoResult, false
+	}
+	if h.Board.IsStalemate() {
+		return Stalemate, true
+	}
+	if h.Board.IsInsufficientMaterial() {
+		return InsufficientMaterial, true
+	}
+	if h.Repetitions() >= 5 {
+		return FivefoldRepetition, true
+	}
+	if h.Board.Halfmoveclock >= 150 {
+		return SeventyFiveMoveRule, true
+	}
+	return NoResult, false
+}
+
+// How many recent positions a board's repetition buffer holds. Positions older
+// than this are forgotten, which only matters after long runs of reversible moves.
+const repetitionBufferSize = 128
+
+// A bounded ring buffer of the hashes of the positions a board has passed through,
+// for detecting repetitions without a separate History.
+type repetitionBuffer struct {
+	hashes       [repetitionBufferSize]uint64
+	count        int // number of positions pushed and not popped
+	oldest       int // index of the oldest position that has not been overwritten
+	irreversible int // index of the position after the most recent irreversible move
+}
+
+// Records a position, and returns the previous irreversible index, for pop().
+func (r *repetitionBuffer) push(hash uint64, irreversible bool) int {
+	oldIrreversible := r.irreversible
+	r.hashes[r.count%repetitionBufferSize] = hash
+	if irreversible {
+		r.irreversible = r.count
+	}
+	r.count++
+	if r.count-repetitionBufferSize > r.oldest {
+		r.oldest = r.count - repetitionBufferSize
+	}
+	return oldIrreversible
+}
+
+// Forgets the most recent position, restoring the previous irreversible index.
+func (r *repetitionBuffer) pop(oldIrreversible int) {
+	r.count--
+	r.irreversible = oldIrreversible
+}
+
+// Starts recording the positions this board passes through, beginning with the
+// current one, so that IsRepetitionDraw() can be used. Apply() and ApplyNullMove()
+// record each new position, and their unapply functions remove it. Copies of the
+// board share the same buffer, so a copy that is played on independently must
+// call this again to get its own.
+func (b *Board) EnableRepetitionTracking() {
+	b.repetitions = &repetitionBuffer{}
+	b.repetitions.push(b.hash, true)
+}
+
+// Returns a copy of the board without repetition tracking, so that moves applied
+// to the copy are not recorded in this board's buffer. Use it whenever a copy is
+// played on internally.
+func (b *Board) detachedCopy() Board {
+	position := *b
+	position.repetitions = nil
+	return position
+}
+
+// Whether the current position has occurred at least three times since the most
+// recent irreversible move (a capture, a pawn move, a loss of castling rights, or a
+// null move). Always false unless EnableRepetitionTracking() was called. Only the
+// most recent positions are remembered, up to an internal limit.
+func (b *Board) IsRepetitionDraw() bool {
+	r := b.repetitions
+	if r == nil {
+		return false
+	}
+	first := r.irreversible
+	if r.oldest > first {
+		first = r.oldest
+	}
+	occurrences := 0
+	for i := r.count - 1; i >= first; i-- {
+		if r.hashes[i%repetitionBufferSize] == b.hash {
+			occurrences++
+		}
+	}
+	return occurrences >= 3
+}
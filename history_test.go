@@ -0,0 +1,235 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestRepetitionDraws(t *testing.T) {
+	h := NewHistory(ParseFen(Startpos))
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+	// after 2 cycles the start position has occurred three times
+	for i := 0; i < 2; i++ {
+		for _, m := range shuffle {
+			h.Apply(parseMove(m))
+		}
+	}
+	if h.Repetitions() != 3 {
+		t.Error("Wrong repetition count. Expected 3 but got", h.Repetitions())
+	}
+	claims := h.ClaimableDraws()
+	if len(claims) != 1 || claims[0] != ThreefoldRepetition {
+		t.Error("Threefold repetition should be claimable. Got", claims)
+	}
+	if _, ok := h.AutomaticDraw(); ok {
+		t.Error("Threefold repetition should not be an automatic draw.")
+	}
+	// after 4 cycles the start position has occurred five times
+	for i := 0; i < 2; i++ {
+		for _, m := range shuffle {
+			h.Apply(parseMove(m))
+		}
+	}
+	if res, ok := h.AutomaticDraw(); !ok || res != FivefoldRepetition {
+		t.Error("Fivefold repetition should be an automatic draw. Got", res, ok)
+	}
+	// an irreversible move ends the repetition window
+	h.Apply(parseMove("e2e4"))
+	if h.Repetitions() != 1 {
+		t.Error("Wrong repetition count after a pawn move:", h.Repetitions())
+	}
+}
+
+func TestMoveClockDraws(t *testing.T) {
+	h := NewHistory(ParseFen("4k3/8/8/8/8/8/4P3/R3K3 w - - 99 80"))
+	h.Apply(parseMove("a1a2"))
+	claims := h.ClaimableDraws()
+	if len(claims) != 1 || claims[0] != FiftyMoveRule {
+		t.Error("Fifty-move rule should be claimable. Got", claims)
+	}
+	if _, ok := h.AutomaticDraw(); ok {
+		t.Error("Fifty-move rule should not be an automatic draw.")
+	}
+	h2 := NewHistory(ParseFen("4k3/8/8/8/8/8/4P3/R3K3 w - - 149 80"))
+	h2.Apply(parseMove("a1a2"))
+	if res, ok := h2.AutomaticDraw(); !ok || res != SeventyFiveMoveRule {
+		t.Error("Seventy-five-move rule should be an automatic draw. Got", res, ok)
+	}
+	// checkmate takes precedence over the move clock
+	h3 := NewHistory(ParseFen("6k1/5ppp/8/8/8/8/8/R3K3 w - - 149 80"))
+	h3.Apply(parseMove("a1a8"))
+	if _, ok := h3.AutomaticDraw(); ok {
+		t.Error("Checkmate should take precedence over the seventy-five-move rule.")
+	}
+	if len(h3.ClaimableDraws()) != 0 {
+		t.Error("No draw can be claimed after checkmate.")
+	}
+}
+
+func TestHalfmovesUntilFiftyMoveDraw(t *testing.T) {
+	clocks := map[string]int{
+		"4k3/8/8/8/8/8/4P3/R3K3 w - - 0 80":   100,
+		"4k3/8/8/8/8/8/4P3/R3K3 w - - 1 80":   99,
+		"4k3/8/8/8/8/8/4P3/R3K3 w - - 99 80":  1,
+		"4k3/8/8/8/8/8/4P3/R3K3 w - - 100 80": 0,
+		"4k3/8/8/8/8/8/4P3/R3K3 w - - 140 80": 0,
+	}
+	for fen, expected := range clocks {
+		b := ParseFen(fen)
+		if halfmoves := b.HalfmovesUntilFiftyMoveDraw(); halfmoves != expected {
+			t.Error("Wrong halfmoves until the fifty-move draw for", fen, "\nExpected", expected, "but got", halfmoves)
+		}
+	}
+	b := ParseFen("4k3/8/8/8/8/8/4P3/R3K3 w - - 99 80")
+	b.Apply(parseMove("a1a2"))
+	if halfmoves := b.HalfmovesUntilFiftyMoveDraw(); halfmoves != 0 {
+		t.Error("The fifty-move draw should be claimable after the clock reaches 100. Got", halfmoves)
+	}
+}
+
+func TestAutomaticDrawPositions(t *testing.T) {
+	positions := map[string]GameResult{
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1":    Stalemate,
+		"8/8/4k3/8/8/2K5/8/8 w - - 0 1":     InsufficientMaterial,
+		"8/8/4k3/8/8/2KN4/8/8 w - - 0 1":    InsufficientMaterial,
+		"8/8/2b1k3/8/8/2KB4/8/8 w - - 0 1":  InsufficientMaterial,
+		"8/8/3bk3/8/8/2KB4/8/8 w - - 0 1":   NoResult,
+		"8/8/4k3/8/8/2KNN3/8/8 w - - 0 1":   NoResult,
+		"8/8/4k3/8/8/2K5/7P/8 w - - 0 1":    NoResult,
+		"6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1": NoResult,
+	}
+	for k, v := range positions {
+		h := NewHistory(ParseFen(k))
+		res, ok := h.AutomaticDraw()
+		if res != v || ok != (v != NoResult) {
+			t.Error("Wrong automatic draw for", k, "\nExpected", v, "but got", res, ok)
+		}
+	}
+}
+
+func TestIsRepetitionDraw(t *testing.T) {
+	b := ParseFen(Startpos)
+	b.EnableRepetitionTracking()
+	knightDance := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+	var unapplies []func()
+	for i := 0; i < 2; i++ {
+		for _, m := range knightDance {
+			if b.IsRepetitionDraw() {
+				t.Error("Reported a repetition draw too early, before", m)
+			}
+			unapplies = append(unapplies, b.Apply(parseMove(m)))
+		}
+	}
+	// the starting position has now occurred three times
+	if !b.IsRepetitionDraw() {
+		t.Error("Failed to detect threefold repetition.")
+	}
+	// unapplying removes the last occurrence
+	unapplies[len(unapplies)-1]()
+	unapplies[len(unapplies)-2]()
+	if b.IsRepetitionDraw() {
+		t.Error("Repetition draw persisted after unapplying moves.")
+	}
+	b.Apply(parseMove("f3g1"))
+	b.Apply(parseMove("f6g8"))
+	if !b.IsRepetitionDraw() {
+		t.Error("Failed to detect threefold repetition after replaying moves.")
+	}
+
+	// positions before an irreversible move do not count
+	b = ParseFen(Startpos)
+	b.EnableRepetitionTracking()
+	for _, m := range knightDance {
+		b.Apply(parseMove(m))
+	}
+	b.Apply(parseMove("e2e4"))
+	b.Apply(parseMove("e7e5"))
+	// the en passant square makes the position after e7e5 distinct, so dance three times
+	for i := 0; i < 3; i++ {
+		for _, m := range knightDance {
+			b.Apply(parseMove(m))
+		}
+	}
+	if !b.IsRepetitionDraw() {
+		t.Error("Failed to detect threefold repetition after a pawn move.")
+	}
+	b = ParseFen("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	b.EnableRepetitionTracking()
+	// the first king moves lose castling rights, so the position only repeats twice
+	for _, m := range []string{"e1f1", "e8f8", "f1e1", "f8e8", "e1f1", "e8f8", "f1e1", "f8e8"} {
+		b.Apply(parseMove(m))
+	}
+	if b.IsRepetitionDraw() {
+		t.Error("Counted positions from before castling rights were lost.")
+	}
+	b.Apply(parseMove("e1f1"))
+	b.Apply(parseMove("e8f8"))
+	b.Apply(parseMove("f1e1"))
+	b.Apply(parseMove("f8e8"))
+	if !b.IsRepetitionDraw() {
+		t.Error("Failed to detect threefold repetition after castling rights were lost.")
+	}
+	// boards without tracking never report a repetition
+	untracked := ParseFen(Startpos)
+	for i := 0; i < 3; i++ {
+		for _, m := range knightDance {
+			untracked.Apply(parseMove(m))
+		}
+	}
+	if untracked.IsRepetitionDraw() {
+		t.Error("Reported a repetition without tracking enabled.")
+	}
+}
+
+func TestRepetitionTrackingCopies(t *testing.T) {
+	b := ParseFen(Startpos)
+	b.EnableRepetitionTracking()
+	for _, m := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+		b.Apply(parseMove(m))
+	}
+	count := b.repetitions.count
+	// helpers that play on internal copies must not record in the board's buffer
+	detached := b.detachedCopy()
+	detached.Apply(parseMove("e2e4"))
+	flipped := b.WithSideToMoveFlipped()
+	flipped.Apply(parseMove("e7e5"))
+	if _, err := ParseUCILine(&b, "g1f3 g8f6 f3g1 f6g8"); err != nil {
+		t.Error("Failed to parse UCI line:", err)
+	}
+	b.TrappedPieces(false)
+	b.PerpetualCheckExists(1)
+	if b.repetitions.count != count {
+		t.Error("Copies recorded positions in the original board's buffer\nExpected", count, "but got", b.repetitions.count)
+	}
+	if detached.IsRepetitionDraw() || flipped.IsRepetitionDraw() {
+		t.Error("A detached copy reported a repetition.")
+	}
+	// a plain copy shares the buffer, as the Board documentation warns
+	shared := b
+	shared.Apply(parseMove("g1f3"))
+	if b.repetitions.count != count+1 {
+		t.Error("A plain copy of the board did not share its repetition buffer.")
+	}
+}
+
+func TestRepetitionBufferWraps(t *testing.T) {
+	b := ParseFen("4k3/8/8/8/8/8/8/R3K3 w - - 0 1")
+	b.EnableRepetitionTracking()
+	// shuffle far past the buffer size; the position keeps repeating
+	rookShuffle := []string{"a1a2", "e8d8", "a2a1", "d8e8"}
+	for i := 0; i < repetitionBufferSize; i++ {
+		for _, m := range rookShuffle {
+			b.Apply(parseMove(m))
+		}
+	}
+	if !b.IsRepetitionDraw() {
+		t.Error("Failed to detect repetition after the buffer wrapped.")
+	}
+	unapply := b.ApplyNullMove()
+	if b.IsRepetitionDraw() {
+		t.Error("Counted positions from before a null move.")
+	}
+	unapply()
+	if !b.IsRepetitionDraw() {
+		t.Error("Failed to detect repetition after unapplying a null move.")
+	}
+}
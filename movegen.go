@@ -14,6 +14,92 @@ import (
 // The main API entrypoint. Generates all legal moves for a given board.
 func (b *Board) GenerateLegalMoves() []Move {
 	moves := make([]Move, 0, kDefaultMoveListLength)
+	b.generateLegalMovesInto(&moves, VariantRules{})
+	return moves
+}
+
+// Generates all legal moves for a given board, except castling moves.
+func (b *Board) GenerateLegalMovesNoCastle() []Move {
+	moves := make([]Move, 0, kDefaultMoveListLength)
+	b.generateLegalMovesInto(&moves, VariantRules{NoCastling: true})
+	return moves
+}
+
+// Generates all legal moves for a given board under the rules of a chess variant.
+// With the zero VariantRules, this is the same as GenerateLegalMoves().
+func (b *Board) GenerateLegalMovesVariant(rules VariantRules) []Move {
+	moves := make([]Move, 0, kDefaultMoveListLength)
+	b.generateLegalMovesInto(&moves, rules)
+	return moves
+}
+
+// Generates the legal moves for many boards at once. The moves for boards[i] are
+// written into out[i], reusing its backing array; out[i] is grown if it is too
+// small, so any preallocated capacity is safe. The out slice must be at least as
+// long as boards.
+func GenerateLegalMovesBatch(boards []Board, out [][]Move) {
+	for i := range boards {
+		moves := out[i][:0]
+		boards[i].generateLegalMovesInto(&moves, VariantRules{})
+		out[i] = moves
+	}
+}
+
+// Returns the legal moves whose destination is the target square: captures, pushes
+// and promotions landing there, and castling moves that bring the king there.
+func (b *Board) LegalMovesTo(target Square) []Move {
+	var moves []Move
+	for _, m := range b.GenerateLegalMoves() {
+		if Square(m.To()) == target {
+			moves = append(moves, m)
+		}
+	}
+	return moves
+}
+
+// Returns the squares that any legal move of the side to move lands on.
+func (b *Board) LegalDestinations() uint64 {
+	var destinations uint64
+	for _, m := range b.GenerateLegalMoves() {
+		destinations |= uint64(1) << m.To()
+	}
+	return destinations
+}
+
+// Returns the squares that the piece on the given square can legally move to.
+// This is empty if the square does not hold a piece of the side to move.
+func (b *Board) LegalDestinationsFrom(s Square) uint64 {
+	var destinations uint64
+	for _, m := range b.GenerateLegalMoves() {
+		if Square(m.From()) == s {
+			destinations |= uint64(1) << m.To()
+		}
+	}
+	return destinations
+}
+
+// Returns the legal en passant captures: none, or one or two when a pawn has just
+// advanced two squares next to the side to move's pawns. A capture that would
+// expose the king, such as along the rank that both pawns leave, is not included.
+func (b *Board) GenerateEnPassant() []Move {
+	if b.enpassant == 0 {
+		return nil
+	}
+	ourPawns := b.White.Pawns
+	if !b.Wtomove {
+		ourPawns = b.Black.Pawns
+	}
+	var captures []Move
+	for _, m := range b.GenerateLegalMoves() {
+		if m.To() == b.enpassant && ourPawns&(uint64(1)<<m.From()) != 0 {
+			captures = append(captures, m)
+		}
+	}
+	return captures
+}
+
+// Appends all legal moves for the board to the move list, following the variant rules.
+func (b *Board) generateLegalMovesInto(moves *[]Move, rules VariantRules) {
 	// First, see if we are currently in check. If we are, invoke a special check-
 	// evasion move generator.
 	var kingLocation uint8
@@ -27,40 +113,39 @@ func (b *Board) GenerateLegalMoves() []Move {
 	}
 	kingAttackers, blockerDestinations := b.countAttacks(b.Wtomove, kingLocation, 2)
 	if kingAttackers >= 2 { // Under multiple attack, we must move the king.
-		b.kingPushes(&moves, ourPiecesPtr)
-		return moves
+		b.kingPushes(moves, ourPiecesPtr)
+		return
 	}
 
 	// Several move types can work in single check, but we must block the check
 	if kingAttackers == 1 {
 		// calculate pinned pieces
-		pinnedPieces := b.generatePinnedMoves(&moves, blockerDestinations)
+		pinnedPieces := b.generatePinnedMoves(moves, blockerDestinations)
 		nonpinnedPieces := ^pinnedPieces
 		// TODO
-		b.pawnPushes(&moves, nonpinnedPieces, blockerDestinations)
-		b.pawnCaptures(&moves, nonpinnedPieces, blockerDestinations)
-		b.knightMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.rookMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.bishopMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.queenMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.kingPushes(&moves, ourPiecesPtr)
-		return moves
+		b.pawnPushes(moves, nonpinnedPieces, blockerDestinations)
+		b.pawnCaptures(moves, nonpinnedPieces, blockerDestinations)
+		b.knightMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.rookMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.bishopMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.queenMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.kingPushes(moves, ourPiecesPtr)
+		return
 	}
 
 	// Then, calculate all the absolutely pinned pieces, and compute their moves.
 	// If we are in check, we can only move to squares that block the check.
-	pinnedPieces := b.generatePinnedMoves(&moves, everything)
+	pinnedPieces := b.generatePinnedMoves(moves, everything)
 	nonpinnedPieces := ^pinnedPieces
 
 	// Finally, compute ordinary moves, ignoring absolutely pinned pieces on the board.
-	b.pawnPushes(&moves, nonpinnedPieces, everything)
-	b.pawnCaptures(&moves, nonpinnedPieces, everything)
-	b.knightMoves(&moves, nonpinnedPieces, everything)
-	b.rookMoves(&moves, nonpinnedPieces, everything)
-	b.bishopMoves(&moves, nonpinnedPieces, everything)
-	b.queenMoves(&moves, nonpinnedPieces, everything)
-	b.kingMoves(&moves)
-	return moves
+	b.pawnPushes(moves, nonpinnedPieces, everything)
+	b.pawnCaptures(moves, nonpinnedPieces, everything)
+	b.knightMoves(moves, nonpinnedPieces, everything)
+	b.rookMoves(moves, nonpinnedPieces, everything)
+	b.bishopMoves(moves, nonpinnedPieces, everything)
+	b.queenMoves(moves, nonpinnedPieces, everything)
+	b.kingMoves(moves, rules)
 }
 
 // Calculate the available moves for absolutely pinned pieces (pinned to the king).
@@ -315,8 +400,6 @@ func (b *Board) pawnCaptures(moveList *[]Move, nonpinned uint64, allowDest uint6
 
 // A helper than generates bitboards for available pawn captures.
 func (b *Board) pawnCaptureBitboards(nonpinned uint64) (east uint64, west uint64) {
-	notHFile := uint64(0x7F7F7F7F7F7F7F7F)
-	notAFile := uint64(0xFEFEFEFEFEFEFEFE)
 	var targets uint64
 	// TODO(dylhunn): Always try the en passant capture and verify check status, regardless of
 	// valid square requirements
@@ -325,14 +408,25 @@ func (b *Board) pawnCaptureBitboards(nonpinned uint64) (east uint64, west uint64
 	}
 	if b.Wtomove {
 		targets |= b.Black.All
-		ourpawns := b.White.Pawns & nonpinned
-		east = ourpawns << 9 & notAFile & targets
-		west = ourpawns << 7 & notHFile & targets
+		east, west = pawnAttackBitboards(b.White.Pawns&nonpinned, true)
 	} else {
 		targets |= b.White.All
-		ourpawns := b.Black.Pawns & nonpinned
-		east = ourpawns >> 7 & notAFile & targets
-		west = ourpawns >> 9 & notHFile & targets
+		east, west = pawnAttackBitboards(b.Black.Pawns&nonpinned, false)
+	}
+	return east & targets, west & targets
+}
+
+// Computes the squares attacked by the given pawns towards the east and west,
+// whether or not there is anything there to capture.
+func pawnAttackBitboards(pawns uint64, white bool) (east uint64, west uint64) {
+	notHFile := uint64(0x7F7F7F7F7F7F7F7F)
+	notAFile := uint64(0xFEFEFEFEFEFEFEFE)
+	if white {
+		east = pawns << 9 & notAFile
+		west = pawns << 7 & notHFile
+	} else {
+		east = pawns >> 7 & notAFile
+		west = pawns >> 9 & notHFile
 	}
 	return
 }
@@ -385,10 +479,10 @@ func (b *Board) kingPushes(moveList *[]Move, ptrToOurBitboards *Bitboards) {
 
 // Generate all available king moves.
 // First, if castling is possible, verifies the checking prohibitions on castling.
-// Then, outputs castling moves (if any), and king moves.
+// Then, outputs castling moves (if any, and if the rules allow castling), and king moves.
 // Not thread-safe, since the king is removed from the board to compute
 // king-danger squares.
-func (b *Board) kingMoves(moveList *[]Move) {
+func (b *Board) kingMoves(moveList *[]Move, rules VariantRules) {
 	// castling
 	var ourKingLocation uint8
 	var canCastleQueenside, canCastleKingside bool
@@ -401,20 +495,24 @@ func (b *Board) kingMoves(moveList *[]Move) {
 		kingsideClear := allPieces&((1<<5)|(1<<6)) == 0
 		queensideClear := allPieces&((1<<3)|(1<<2)|(1<<1)) == 0
 		// skip the king square, since this won't be called while in check
-		canCastleQueenside = b.whiteCanCastleQueenside() &&
-			queensideClear && !b.anyUnderDirectAttack(true, 2, 3)
-		canCastleKingside = b.whiteCanCastleKingside() &&
-			kingsideClear && !b.anyUnderDirectAttack(true, 5, 6)
+		canCastleQueenside = !rules.NoCastling && b.whiteCanCastleQueenside() &&
+			b.standardCastleGeometry(WhiteQueenside, ourKingLocation) &&
+			queensideClear && b.castlePathSafe(true, 2, 3, rules.CastleThroughCheck)
+		canCastleKingside = !rules.NoCastling && b.whiteCanCastleKingside() &&
+			b.standardCastleGeometry(WhiteKingside, ourKingLocation) &&
+			kingsideClear && b.castlePathSafe(true, 6, 5, rules.CastleThroughCheck)
 	} else {
 		ourKingLocation = uint8(bits.TrailingZeros64(b.Black.Kings))
 		ptrToOurBitboards = &(b.Black)
 		kingsideClear := allPieces&((1<<61)|(1<<62)) == 0
 		queensideClear := allPieces&((1<<57)|(1<<58)|(1<<59)) == 0
 		// skip the king square, since this won't be called while in check
-		canCastleQueenside = b.blackCanCastleQueenside() &&
-			queensideClear && !b.anyUnderDirectAttack(false, 58, 59)
-		canCastleKingside = b.blackCanCastleKingside() &&
-			kingsideClear && !b.anyUnderDirectAttack(false, 61, 62)
+		canCastleQueenside = !rules.NoCastling && b.blackCanCastleQueenside() &&
+			b.standardCastleGeometry(BlackQueenside, ourKingLocation) &&
+			queensideClear && b.castlePathSafe(false, 58, 59, rules.CastleThroughCheck)
+		canCastleKingside = !rules.NoCastling && b.blackCanCastleKingside() &&
+			b.standardCastleGeometry(BlackKingside, ourKingLocation) &&
+			kingsideClear && b.castlePathSafe(false, 62, 61, rules.CastleThroughCheck)
 	}
 	if canCastleKingside {
 		var move Move
@@ -506,6 +604,16 @@ func genMovesFromTargets(moveList *[]Move, origin Square, targets uint64) {
 	}
 }
 
+// Whether the king may castle past the passing square to the landing square without
+// being attacked on either one. If throughCheck is set, only the landing square
+// matters, since the king may never castle into check.
+func (b *Board) castlePathSafe(byBlack bool, landing uint8, passing uint8, throughCheck bool) bool {
+	if throughCheck {
+		return !b.UnderDirectAttack(byBlack, landing)
+	}
+	return !b.anyUnderDirectAttack(byBlack, landing, passing)
+}
+
 // Variadic function that returns whether any of the specified squares is being attacked
 // by the opponent. Potentially expensive.
 func (b *Board) anyUnderDirectAttack(byBlack bool, squares ...uint8) bool {
@@ -3,6 +3,8 @@ package dragontoothmg
 import (
 	"fmt"
 	"math/bits"
+	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -91,7 +93,7 @@ func TestKingPositions(t *testing.T) {
 	for k, v := range positions {
 		moves := make([]Move, 0, 45)
 		b := ParseFen(k)
-		b.kingMoves(&moves)
+		b.kingMoves(&moves, VariantRules{})
 		if len(moves) != v {
 			t.Error("King moves: wrong length. Expected", v, "but got",
 				len(moves), "\nFor position:", k)
@@ -542,3 +544,239 @@ func TestLegalMoves(t *testing.T) {
 		}
 	}
 }
+
+// Builds a deterministic set of positions by playing out pseudo-random games.
+func batchTestPositions(count int) []Board {
+	starts := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+	r := rand.New(rand.NewSource(1))
+	boards := make([]Board, 0, count)
+	for len(boards) < count {
+		b := ParseFen(starts[len(boards)%len(starts)])
+		for ply := 0; ply < 40 && len(boards) < count; ply++ {
+			moves := b.GenerateLegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			b.Apply(moves[r.Intn(len(moves))])
+			boards = append(boards, b)
+		}
+	}
+	return boards
+}
+
+func TestGenerateLegalMovesBatch(t *testing.T) {
+	boards := batchTestPositions(500)
+	out := make([][]Move, len(boards))
+	for i := range out {
+		// deliberately undersized for some boards, to exercise growth
+		out[i] = make([]Move, 0, i%8)
+	}
+	GenerateLegalMovesBatch(boards, out)
+	for i := range boards {
+		expected := boards[i].GenerateLegalMoves()
+		if len(out[i]) != len(expected) {
+			t.Error("Batch generation: wrong length. Expected", len(expected), "but got",
+				len(out[i]), "for position", boards[i].ToFen())
+			continue
+		}
+		for j := range expected {
+			if out[i][j] != expected[j] {
+				t.Error("Batch generation produced a different move list for position", boards[i].ToFen())
+				break
+			}
+		}
+	}
+	// a second call must reuse the buffers and produce the same result
+	GenerateLegalMovesBatch(boards, out)
+	for i := range boards {
+		if len(out[i]) != len(boards[i].GenerateLegalMoves()) {
+			t.Error("Batch generation did not reset the output slices.")
+			break
+		}
+	}
+}
+
+func BenchmarkGenerateLegalMovesBatch(b *testing.B) {
+	boards := batchTestPositions(10000)
+	out := make([][]Move, len(boards))
+	for i := range out {
+		out[i] = make([]Move, 0, kDefaultMoveListLength)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GenerateLegalMovesBatch(boards, out)
+	}
+}
+
+func BenchmarkGenerateLegalMovesPerBoard(b *testing.B) {
+	boards := batchTestPositions(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range boards {
+			boards[j].GenerateLegalMoves()
+		}
+	}
+}
+
+func TestLegalMovesTo(t *testing.T) {
+	type query struct {
+		target string
+		count  int
+	}
+	positions := map[string]query{
+		// contested e5 pawn, attacked by a pawn and a knight
+		"r1bqkb1r/pppp1ppp/2n2n2/4p3/3PP3/5N2/PPP2PPP/RNBQKB1R w KQkq - 0 4": {"e5", 2},
+		// the d3 knight is pinned, so only the pawn may capture
+		"4k3/8/b7/4p3/3P4/3N4/8/5K2 w - - 0 1": {"e5", 1},
+		// castling and a rook move both reach g1
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": {"g1", 2},
+		// four promotions land on g1
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1": {"g1", 4},
+		// empty and unreachable
+		Startpos: {"e5", 0},
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		target := Square(algebraicToIndexFatal(v.target))
+		moves := b.LegalMovesTo(target)
+		if len(moves) != v.count {
+			t.Error("Legal moves to", v.target, ": wrong length. Expected", v.count, "but got",
+				len(moves), "for FEN", k)
+		}
+		for _, m := range moves {
+			if Square(m.To()) != target {
+				t.Error("Legal moves to", v.target, "includes", &m, "for FEN", k)
+			}
+		}
+	}
+}
+
+func TestGenerateLegalMovesNoCastle(t *testing.T) {
+	positions := map[string]int{
+		// both castles are available
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1": 2,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1": 2,
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1":                                 2,
+		Startpos:                                                               0,
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		all := b.GenerateLegalMoves()
+		noCastle := b.GenerateLegalMovesNoCastle()
+		if len(all)-len(noCastle) != v {
+			t.Error("Expected", v, "castling moves to be excluded but got", len(all)-len(noCastle), "for", k)
+		}
+		for _, m := range all {
+			piece, _ := b.pieceAt(Square(m.From()))
+			castle := piece == King && (int(m.To())-int(m.From()) == 2 || int(m.From())-int(m.To()) == 2)
+			found := false
+			for _, other := range noCastle {
+				found = found || other == m
+			}
+			if castle == found {
+				t.Error("Move", &m, "is wrongly present or absent without castling in", k)
+			}
+		}
+	}
+}
+
+func TestGenerateLegalMovesVariant(t *testing.T) {
+	throughCheck := VariantRules{CastleThroughCheck: true}
+	positions := []struct {
+		fen      string
+		standard []string
+		variant  []string
+	}{
+		// f1 is attacked, and c1 is attacked as well
+		{"2r1kr2/8/8/8/8/8/8/R3K2R w KQ - 0 1", nil, []string{"e1g1"}},
+		// d1 is attacked, but not c1
+		{"3rk3/8/8/8/8/8/8/R3K2R w KQ - 0 1", []string{"e1g1"}, []string{"e1g1", "e1c1"}},
+		{"r3k2r/8/8/8/8/8/8/5R2 b kq - 0 1", []string{"e8c8"}, []string{"e8g8", "e8c8"}},
+		// castling out of check is never allowed
+		{"4r1k1/8/8/8/8/8/8/R3K2R w KQ - 0 1", nil, nil},
+	}
+	for _, p := range positions {
+		b := ParseFen(p.fen)
+		for _, rules := range []VariantRules{{}, throughCheck} {
+			expected := p.standard
+			if rules.CastleThroughCheck {
+				expected = p.variant
+			}
+			var castles []string
+			for _, m := range b.GenerateLegalMovesVariant(rules) {
+				if piece, _ := b.pieceAt(Square(m.From())); piece == King &&
+					(int(m.To())-int(m.From()) == 2 || int(m.From())-int(m.To()) == 2) {
+					castles = append(castles, m.String())
+				}
+			}
+			if strings.Join(castles, " ") != strings.Join(expected, " ") {
+				t.Error("Wrong castling moves for", p.fen, "with rules", rules, "\nExpected", expected, "but got", castles)
+			}
+		}
+	}
+	// the default rules are standard chess
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if WriteUCILine(b.GenerateLegalMovesVariant(VariantRules{})) != WriteUCILine(b.GenerateLegalMoves()) {
+		t.Error("The default variant rules do not match standard chess.")
+	}
+	if len(b.GenerateLegalMovesVariant(VariantRules{NoCastling: true})) != len(b.GenerateLegalMovesNoCastle()) {
+		t.Error("NoCastling does not match GenerateLegalMovesNoCastle().")
+	}
+}
+
+func TestLegalDestinations(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/8/8/K1pP3r/8/8/8/7k w - c6 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		var expected uint64
+		expectedFrom := make(map[Square]uint64)
+		for _, m := range b.GenerateLegalMoves() {
+			expected |= uint64(1) << m.To()
+			expectedFrom[Square(m.From())] |= uint64(1) << m.To()
+		}
+		if destinations := b.LegalDestinations(); destinations != expected {
+			t.Error("Wrong legal destinations for", fen, "\nExpected", expected, "but got", destinations)
+		}
+		for s := Square(0); s < 64; s++ {
+			if destinations := b.LegalDestinationsFrom(s); destinations != expectedFrom[s] {
+				t.Error("Wrong legal destinations from", IndexToAlgebraic(s), "for", fen)
+			}
+		}
+	}
+	// the knights in the starting position
+	b := ParseFen(Startpos)
+	if destinations := b.LegalDestinationsFrom(Square(algebraicToIndexFatal("g1"))); destinations !=
+		uint64(1)<<algebraicToIndexFatal("f3")|uint64(1)<<algebraicToIndexFatal("h3") {
+		t.Error("Wrong legal destinations for the g1 knight:", destinations)
+	}
+}
+
+func TestGenerateEnPassant(t *testing.T) {
+	positions := map[string]string{
+		Startpos:                             "",
+		"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1":  "e5d6",
+		"4k3/8/8/2PpP3/8/8/8/4K3 w - d6 0 1": "c5d6 e5d6",
+		"4k3/8/8/8/3Pp3/8/8/4K3 b - d3 0 1":  "e4d3",
+		// the capture would leave the king in check along the fifth rank
+		"8/8/8/K2pP2r/8/8/8/4k3 w - d6 0 1": "",
+		"4k3/8/8/2PpP3/8/8/8/4K3 w - - 0 1": "",
+	}
+	for k, v := range positions {
+		b := ParseFen(k)
+		moves := b.GenerateEnPassant()
+		SortMoves(moves)
+		if line := WriteUCILine(moves); line != v {
+			t.Error("Wrong en passant captures for", k, "\nExpected", v, "but got", line)
+		}
+	}
+}
@@ -21,6 +21,34 @@ func Perft(b *Board, n int) int64 {
 	return int64(count)
 }
 
+// Parses a FEN string and runs Perft on it to the given depth.
+// Returns an error if the FEN is malformed.
+func PerftFEN(fen string, depth int) (uint64, error) {
+	b, err := ParseFenSafe(fen)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(Perft(&b, depth)), nil
+}
+
+// Returns the legal moves of the position given by a FEN string, as sorted UCI
+// strings. This is the format of the golden files used to test the move generator,
+// and can be used to compare other move generators against this one.
+// Returns an error if the FEN is malformed.
+func GoldenMoves(fen string) ([]string, error) {
+	b, err := ParseFenSafe(fen)
+	if err != nil {
+		return nil, err
+	}
+	moves := b.GenerateLegalMoves()
+	SortMoves(moves)
+	uci := make([]string, len(moves))
+	for i := range moves {
+		uci[i] = moves[i].String()
+	}
+	return uci, nil
+}
+
 // Performs the Perft move count division operation. Useful for debugging.
 func Divide(b *Board, n int) {
 	moves := b.GenerateLegalMoves()
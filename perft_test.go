@@ -133,3 +133,34 @@ func checkPerftResults(fen string, perftSolutions map[int]int64, t *testing.T) {
 		}
 	}
 }
+
+func TestPerftFEN(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		for depth := 1; depth <= 3; depth++ {
+			result, err := PerftFEN(fen, depth)
+			if err != nil {
+				t.Error("PerftFEN failed for", fen, ":", err)
+			}
+			if expected := Perft(&b, depth); result != uint64(expected) {
+				t.Error("PerftFEN error in position\n", fen, "\nExpected", expected,
+					"but got", result, "for depth", depth)
+			}
+		}
+	}
+	malformed := []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+	}
+	for _, fen := range malformed {
+		if _, err := PerftFEN(fen, 1); err == nil {
+			t.Error("PerftFEN accepted a malformed FEN:", fen)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dragontoothmg
+
+// Writing moves in Standard Algebraic Notation (SAN), such as "Nf3", "exd5",
+// "O-O" or "e8=Q#", and in long algebraic notation, such as "Ng1-f3".
+
+// The SAN letter of each piece type, indexed by Piece. Pawns have no letter.
+var sanPieceLetters = [7]string{Nothing: "", Pawn: "", Knight: "N", Bishop: "B", Rook: "R", Queen: "Q", King: "K"}
+
+// Returns the move in Standard Algebraic Notation, disambiguated against the other
+// legal moves and with a "+" or "#" suffix if it gives check or mate. The move
+// must be legal in the current position.
+func (b *Board) ToSAN(m Move) string {
+	return b.toSAN(m, b.GenerateLegalMoves())
+}
+
+// Returns the SAN of every legal move, in the order of GenerateLegalMoves().
+func (b *Board) LegalMovesSAN() []string {
+	legal := b.GenerateLegalMoves()
+	sans := make([]string, len(legal))
+	for i, m := range legal {
+		sans[i] = b.toSAN(m, legal)
+	}
+	return sans
+}
+
+// Returns the SAN of a move, given all of the legal moves in the position.
+func (b *Board) toSAN(m Move, legal []Move) string {
+	ourPieces := &(b.White)
+	if !b.Wtomove {
+		ourPieces = &(b.Black)
+	}
+	from, to := Square(m.From()), Square(m.To())
+	pieceType, _ := determinePieceType(ourPieces, uint64(1)<<from)
+	isCapture := IsCapture(m, b)
+
+	var san string
+	switch {
+	case pieceType == King && to == from+2:
+		san = "O-O"
+	case pieceType == King && to+2 == from:
+		san = "O-O-O"
+	case pieceType == Pawn:
+		if isCapture {
+			san = IndexToAlgebraic(from)[:1] + "x"
+		}
+		san += IndexToAlgebraic(to)
+		if promote := m.Promote(); promote != Nothing {
+			san += "=" + sanPieceLetters[promote]
+		}
+	default:
+		san = sanPieceLetters[pieceType] + b.sanDisambiguation(m, pieceType, legal)
+		if isCapture {
+			san += "x"
+		}
+		san += IndexToAlgebraic(to)
+	}
+
+	return san + b.checkSuffix(m)
+}
+
+// Returns the move in long algebraic notation, which names the piece and both
+// squares, such as "Ng1-f3", "e4xd5", "e7-e8=Q+" or "O-O", as used by some
+// databases and older engines. The move must be legal in the current position.
+func (b *Board) ToLongAlgebraic(m Move) string {
+	ourPieces := &(b.White)
+	if !b.Wtomove {
+		ourPieces = &(b.Black)
+	}
+	from, to := Square(m.From()), Square(m.To())
+	pieceType, _ := determinePieceType(ourPieces, uint64(1)<<from)
+	isCapture := IsCapture(m, b)
+
+	var long string
+	switch {
+	case pieceType == King && to == from+2:
+		long = "O-O"
+	case pieceType == King && to+2 == from:
+		long = "O-O-O"
+	default:
+		separator := "-"
+		if isCapture {
+			separator = "x"
+		}
+		long = sanPieceLetters[pieceType] + IndexToAlgebraic(from) + separator + IndexToAlgebraic(to)
+		if promote := m.Promote(); promote != Nothing {
+			long += "=" + sanPieceLetters[promote]
+		}
+	}
+	return long + b.checkSuffix(m)
+}
+
+// Returns "#" if the legal move mates, "+" if it gives check, and "" otherwise.
+func (b *Board) checkSuffix(m Move) string {
+	unapply := b.Apply(m)
+	defer unapply()
+	if !b.OurKingInCheck() {
+		return ""
+	}
+	if len(b.GenerateLegalMoves()) == 0 {
+		return "#"
+	}
+	return "+"
+}
+
+// Returns the file, rank or square of the moving piece needed to tell the move apart
+// from legal moves of other pieces of the same type to the same square: the file
+// if that is enough, otherwise the rank, otherwise both.
+func (b *Board) sanDisambiguation(m Move, pieceType Piece, legal []Move) string {
+	ourPieces := &(b.White)
+	if !b.Wtomove {
+		ourPieces = &(b.Black)
+	}
+	from := m.From()
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, other := range legal {
+		if other.To() != m.To() || other.From() == from {
+			continue
+		}
+		if otherType, _ := determinePieceType(ourPieces, uint64(1)<<other.From()); otherType != pieceType {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || other.From()%8 == from%8
+		sameRank = sameRank || other.From()/8 == from/8
+	}
+	square := IndexToAlgebraic(Square(from))
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return square[:1]
+	case !sameRank:
+		return square[1:]
+	}
+	return square
+}
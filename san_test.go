@@ -0,0 +1,90 @@
+package dragontoothmg
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestToSAN(t *testing.T) {
+	tests := []struct {
+		fen  string
+		move string
+		san  string
+	}{
+		{Startpos, "g1f3", "Nf3"},
+		{Startpos, "e2e4", "e4"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "e4d5", "exd5"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "exf6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1", "g2h1q", "gxh1=Q"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1", "g2g1n", "g1=N+"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "a1d1", "Rad1"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "h1e1", "Rhe1"},
+		{"4k3/R7/8/8/8/8/8/R3K3 w - - 0 1", "a1a4", "R1a4"},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8+"},
+		// three queens reach d4: the one on a1 shares a file and a rank with the others
+		{"8/7k/8/8/Q7/8/8/Q2Q3K w - - 0 1", "a1d4", "Qa1d4"},
+		{"8/7k/8/8/Q7/8/8/Q2Q3K w - - 0 1", "a4d4", "Q4d4"},
+		{"8/7k/8/8/Q7/8/8/Q2Q3K w - - 0 1", "d1d4", "Qdd4"},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if san := b.ToSAN(parseMove(test.move)); san != test.san {
+			t.Error("Wrong SAN for", test.move, "in", test.fen, "\nExpected", test.san, "but got", san)
+		}
+		if b.ToFen() != test.fen {
+			t.Error("Writing SAN modified the board.")
+		}
+	}
+}
+
+func TestToLongAlgebraic(t *testing.T) {
+	tests := []struct {
+		fen  string
+		move string
+		long string
+	}{
+		{Startpos, "g1f3", "Ng1-f3"},
+		{Startpos, "e2e4", "e2-e4"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "e4d5", "e4xd5"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "e5xf6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e5f7", "Ne5xf7"},
+		{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8q", "e7-e8=Q+"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1", "g2h1q", "g2xh1=Q"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra1-a8#"},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra1-a8+"},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if long := b.ToLongAlgebraic(parseMove(test.move)); long != test.long {
+			t.Error("Wrong long algebraic notation for", test.move, "in", test.fen, "\nExpected", test.long, "but got", long)
+		}
+		if b.ToFen() != test.fen {
+			t.Error("Writing long algebraic notation modified the board.")
+		}
+	}
+}
+
+func TestLegalMovesSAN(t *testing.T) {
+	positions := map[string]string{
+		Startpos: "Na3 Nc3 Nf3 Nh3 a3 a4 b3 b4 c3 c4 d3 d4 e3 e4 f3 f4 g3 g4 h3 h4",
+		// both knights reach d2, and the rook mates on the back rank
+		"6k1/5ppp/8/8/8/8/8/RN2KN2 w - - 0 1": "Kd1 Kd2 Ke2 Kf2 Na3 Nc3 Nbd2 Nfd2 Ne3 Ng3 Nh2 " +
+			"Ra2 Ra3 Ra4 Ra5 Ra6 Ra7 Ra8#",
+	}
+	for fen, expected := range positions {
+		b := ParseFen(fen)
+		sans := b.LegalMovesSAN()
+		sort.Strings(sans)
+		want := strings.Fields(expected)
+		sort.Strings(want)
+		if strings.Join(sans, " ") != strings.Join(want, " ") {
+			t.Error("Wrong SAN moves for", fen, "\nExpected", want, "\nbut got ", sans)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package dragontoothmg
+
+// A minimal negamax search, as a reference for plugging an evaluation function
+// into the move generator. It has no transposition table, move ordering or
+// quiescence search, and is not meant to be competitive.
+
+// The score of delivering checkmate. Search() reports a mate in n plies as
+// MateScore - n, and being mated in n plies as -(MateScore - n).
+const MateScore = 1000000
+
+// Searches the position to the given depth in plies with alpha-beta negamax, and
+// returns the best move with its score. The evaluator must score the board from
+// the perspective of the side to move, and is called at the leaves that are not
+// checkmate or stalemate. Stalemate scores 0. If the side to move has no legal
+// moves, the returned move is NullMove. The board is restored before returning.
+func Search(b *Board, depth int, eval func(*Board) int) (Move, int) {
+	if depth < 1 {
+		depth = 1
+	}
+	moves := b.GenerateLegalMoves()
+	if len(moves) == 0 {
+		return NullMove, terminalScore(b, 0)
+	}
+	best, alpha := moves[0], -MateScore-1
+	for _, m := range moves {
+		unapply := b.Apply(m)
+		score := -negamax(b, depth-1, -MateScore-1, -alpha, 1, eval)
+		unapply()
+		if score > alpha {
+			best, alpha = m, score
+		}
+	}
+	return best, alpha
+}
+
+// Returns the negamax score of the position, from the side to move's perspective.
+func negamax(b *Board, depth int, alpha int, beta int, ply int, eval func(*Board) int) int {
+	moves := b.GenerateLegalMoves()
+	if len(moves) == 0 {
+		return terminalScore(b, ply)
+	}
+	if depth == 0 {
+		return eval(b)
+	}
+	for _, m := range moves {
+		unapply := b.Apply(m)
+		score := -negamax(b, depth-1, -beta, -alpha, ply+1, eval)
+		unapply()
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return alpha
+}
+
+// Scores a position with no legal moves, reached after the given number of plies.
+func terminalScore(b *Board, ply int) int {
+	if b.OurKingInCheck() {
+		return -(MateScore - ply)
+	}
+	return 0
+}
+
+// Applies the move and searches the opponent's legal replies one ply deep, then
+// unapplies it. Returns the opponent's best reply and its score, from the
+// opponent's perspective, with the evaluator scoring the positions after each
+// reply as in Search(). This checks whether a candidate move is refuted. If the
+// opponent has no reply, because the move mates or stalemates, the reply is NullMove.
+func (b *Board) BestRefutation(m Move, eval func(*Board) int) (Move, int) {
+	unapply := b.Apply(m)
+	reply, score := Search(b, 1, eval)
+	unapply()
+	return reply, score
+}
+
+// Whether the side to move can force a draw by perpetual check within the given
+// number of its own moves: it has a sequence of checks such that every reply of the
+// opponent either repeats an earlier position, or allows another check that keeps
+// the sequence going. Being able to give checkmate along the way also counts.
+func (b *Board) PerpetualCheckExists(depth int) bool {
+	position := b.detachedCopy()
+	return position.perpetualCheck(depth, []uint64{position.hash})
+}
+
+// Searches for a perpetual check, given the hashes of the earlier positions with
+// the same side to move.
+func (b *Board) perpetualCheck(depth int, seen []uint64) bool {
+	if depth <= 0 {
+		return false
+	}
+	for _, check := range b.GenerateChecks() {
+		unapplyCheck := b.Apply(check)
+		forced := true
+		for _, reply := range b.GenerateLegalMoves() {
+			unapplyReply := b.Apply(reply)
+			repeated := false
+			for _, h := range seen {
+				repeated = repeated || h == b.hash
+			}
+			if !repeated && !b.perpetualCheck(depth-1, append(seen, b.hash)) {
+				forced = false
+			}
+			unapplyReply()
+			if !forced {
+				break
+			}
+		}
+		unapplyCheck()
+		if forced {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+// Scores the material balance from the side to move's perspective.
+func materialEval(b *Board) int {
+	if b.Wtomove {
+		return b.Material()
+	}
+	return -b.Material()
+}
+
+func TestSearchMateInOne(t *testing.T) {
+	positions := map[string]string{
+		"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1": "a1a8",
+		"r5k1/8/8/8/8/8/5PPP/6K1 b - - 0 1": "a8a1",
+		"7k/6pp/8/8/8/8/1Q6/K7 w - - 0 1":   "b2b8",
+	}
+	for fen, expected := range positions {
+		b := ParseFen(fen)
+		move, score := Search(&b, 2, materialEval)
+		if move.String() != expected || score != MateScore-1 {
+			t.Error("Failed to find mate in one in", fen, "\nExpected", expected, "but got", &move, score)
+		}
+		if b.ToFen() != fen {
+			t.Error("Search modified the board.")
+		}
+	}
+}
+
+func TestSearchMateInTwo(t *testing.T) {
+	b := ParseFen("k7/8/2K5/8/8/8/8/1R6 w - - 0 1")
+	move, score := Search(&b, 3, materialEval)
+	if score != MateScore-3 {
+		t.Error("Failed to find mate in two. Got", &move, score)
+	}
+	b.Apply(move)
+	if _, score := Search(&b, 2, materialEval); score != -(MateScore - 2) {
+		t.Error("The move", &move, "does not force mate. Score:", score)
+	}
+}
+
+func TestSearchTerminal(t *testing.T) {
+	stalemate := ParseFen("k7/2Q5/1K6/8/8/8/8/8 b - - 0 1")
+	if move, score := Search(&stalemate, 2, materialEval); !move.IsNull() || score != 0 {
+		t.Error("Wrong search result for stalemate:", &move, score)
+	}
+	mated := ParseFen("k7/1Q6/1K6/8/8/8/8/8 b - - 0 1")
+	if move, score := Search(&mated, 2, materialEval); !move.IsNull() || score != -MateScore {
+		t.Error("Wrong search result for checkmate:", &move, score)
+	}
+}
+
+func TestBestRefutation(t *testing.T) {
+	// the queen takes a defended pawn, and is recaptured
+	b := ParseFen("4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1")
+	if reply, score := b.BestRefutation(parseMove("d1d5"), materialEval); reply.String() != "e6d5" || score != 100 {
+		t.Error("Wrong refutation of the queen capture. Got", &reply, score)
+	}
+	// with the pawn undefended, black can only move the king
+	b = ParseFen("4k3/8/8/3p4/8/8/8/3QK3 w - - 0 1")
+	reply, score := b.BestRefutation(parseMove("d1d5"), materialEval)
+	if score != -900 || reply.From() != algebraicToIndexFatal("e8") {
+		t.Error("The queen capture should not be refuted. Got", &reply, score)
+	}
+	if b.ToFen() != "4k3/8/8/3p4/8/8/8/3QK3 w - - 0 1" {
+		t.Error("Finding a refutation modified the board.")
+	}
+	// a mating move has no refutation
+	b = ParseFen("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	if reply, score := b.BestRefutation(parseMove("a1a8"), materialEval); !reply.IsNull() || score != -MateScore {
+		t.Error("Wrong refutation for a mating move. Got", &reply, score)
+	}
+}
+
+func TestPerpetualCheckExists(t *testing.T) {
+	// Qh5+ Kg8 Qe8+ Kh7 Qh5+ repeats, and the king cannot escape
+	b := ParseFen("7k/pp4p1/8/8/8/8/8/K2Q4 w - - 0 1")
+	if b.PerpetualCheckExists(2) {
+		t.Error("The perpetual check needs three checks to repeat a position.")
+	}
+	if !b.PerpetualCheckExists(3) {
+		t.Error("Failed to find the perpetual check.")
+	}
+	if b.ToFen() != "7k/pp4p1/8/8/8/8/8/K2Q4 w - - 0 1" {
+		t.Error("Searching for a perpetual check modified the board.")
+	}
+	// the king escapes the checks through its luft on h7
+	noPerpetual := []string{
+		"6k1/pp3pp1/7p/8/8/8/8/K2Q4 w - - 0 1",
+		Startpos,
+	}
+	for _, fen := range noPerpetual {
+		b := ParseFen(fen)
+		if b.PerpetualCheckExists(3) {
+			t.Error("Found a perpetual check in", fen)
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package dragontoothmg
 
+import (
+	"math/bits"
+)
+
 // Each bitboard shall use little-endian rank-file mapping:
 // 56  57  58  59  60  61  62  63
 // 48  49  50  51  52  53  54  55
@@ -14,6 +18,9 @@ package dragontoothmg
 // H8 G8 F8 E8 D8 C8 B8 A8 H7 ... A2 H1 G1 F1 E1 D1 C1 B1 A1
 
 // The board type, which uses little-endian rank-file mapping.
+// A Board can be copied by value, except that a copy of a board with repetition
+// tracking enabled (see EnableRepetitionTracking()) shares its buffer: moves
+// applied to either board are recorded in both boards' history.
 type Board struct {
 	Wtomove       bool
 	enpassant     uint8 // square id (16-23 or 40-47) where en passant capture is possible
@@ -23,6 +30,9 @@ type Board struct {
 	White         Bitboards
 	Black         Bitboards
 	hash          uint64
+	material      int16             // incrementally updated value of Material()
+	repetitions   *repetitionBuffer // recent position hashes, if repetition tracking is enabled
+	castleFiles   [4]uint8          // per castling right, file+1 of its rook if the FEN named the file
 }
 
 // Return the Zobrist hash value for the board.
@@ -42,6 +52,64 @@ func (b *Board) Hash() uint64 {
 // This just indicates whether castling rights have been lost, not whether
 // castling is actually possible.
 
+// The castling rights of a board, as a set of bit flags.
+// The flags match the internal representation described above.
+type CastleRights uint8
+
+const (
+	WhiteQueenside CastleRights = 1 << iota
+	WhiteKingside
+	BlackQueenside
+	BlackKingside
+)
+
+// All four castling rights.
+const AllCastleRights = WhiteQueenside | WhiteKingside | BlackQueenside | BlackKingside
+
+// Returns the castling rights currently held on the board.
+func (b *Board) CastlingRights() CastleRights {
+	return CastleRights(b.castlerights)
+}
+
+// Replaces the castling rights on the board, keeping the hash up to date.
+// This does not verify that the kings and rooks are on their home squares.
+func (b *Board) SetCastlingRights(r CastleRights) {
+	changed := CastleRights(b.castlerights) ^ (r & AllCastleRights)
+	if changed&WhiteQueenside != 0 {
+		b.flipWhiteQueensideCastle()
+	}
+	if changed&WhiteKingside != 0 {
+		b.flipWhiteKingsideCastle()
+	}
+	if changed&BlackQueenside != 0 {
+		b.flipBlackQueensideCastle()
+	}
+	if changed&BlackKingside != 0 {
+		b.flipBlackKingsideCastle()
+	}
+}
+
+// Returns the en passant square as written in FEN: the square that a pawn capturing
+// en passant would land on. The second value is false if no en passant capture is
+// possible. For the square of the pawn that would be captured, use
+// EnPassantPawnSquare().
+func (b *Board) EnPassantSquare() (Square, bool) {
+	return Square(b.enpassant), b.enpassant != 0
+}
+
+// Returns the square of the pawn that can be captured en passant, which is how some
+// engines store the en passant state. The second value is false if no en passant
+// capture is possible.
+func (b *Board) EnPassantPawnSquare() (Square, bool) {
+	if b.enpassant == 0 {
+		return 0, false
+	}
+	if b.enpassant < 32 { // a white pawn just made a double push
+		return Square(b.enpassant + 8), true
+	}
+	return Square(b.enpassant - 8), true
+}
+
 // Castling helper functions for all 16 possible scenarios
 func (b *Board) whiteCanCastleQueenside() bool {
 	return b.castlerights&1 == 1
@@ -55,6 +123,49 @@ func (b *Board) blackCanCastleQueenside() bool {
 func (b *Board) blackCanCastleKingside() bool {
 	return (b.castlerights&0x8)>>3 == 1
 }
+
+// Whether a castling right can be played with the standard chess geometry: the king
+// on its home square, and the rook (if the FEN named its file) on the corner square.
+// Chess960 castling, with the king or rooks elsewhere, is not supported by the move
+// generator, so castling moves are not generated for such rights.
+func (b *Board) standardCastleGeometry(r CastleRights, ourKingLocation uint8) bool {
+	kingHome := uint8(4)
+	if r&(BlackQueenside|BlackKingside) != 0 {
+		kingHome = 60
+	}
+	rookFile := uint8(7)
+	if r&(WhiteQueenside|BlackQueenside) != 0 {
+		rookFile = 0
+	}
+	file := b.castleFiles[bits.TrailingZeros8(uint8(r))]
+	return ourKingLocation == kingHome && (file == 0 || file == rookFile+1)
+}
+
+// Returns the home square of the rook for a single castling right: on the file
+// the FEN named for the right, or otherwise in the corner on that right's side.
+func (b *Board) castlingRookSquare(r CastleRights) uint8 {
+	file := b.castleFiles[bits.TrailingZeros8(uint8(r))]
+	if file == 0 {
+		file = 1
+		if r&(WhiteKingside|BlackKingside) != 0 {
+			file = 8
+		}
+	}
+	square := file - 1
+	if r&(BlackQueenside|BlackKingside) != 0 {
+		square += 56
+	}
+	return square
+}
+
+// Forgets the rook files of castling rights that are no longer held.
+func (b *Board) clearLostCastleFiles() {
+	for i := range b.castleFiles {
+		if b.castlerights&(1<<uint(i)) == 0 {
+			b.castleFiles[i] = 0
+		}
+	}
+}
 func (b *Board) canCastleQueenside() bool {
 	if b.Wtomove {
 		return b.whiteCanCastleQueenside()
@@ -139,14 +250,55 @@ type Bitboards struct {
 	All     uint64
 }
 
+// Rule changes for chess variants, for GenerateLegalMovesVariant(). The zero value
+// is standard chess.
+type VariantRules struct {
+	NoCastling         bool // castling moves are never generated
+	CastleThroughCheck bool // the king may castle across an attacked square, but not out of or into check
+}
+
+// Returns the bitboard of the pieces of the given type and color, or 0 for Nothing.
+func (b *Board) Pieces(p Piece, white bool) uint64 {
+	pieces := &(b.White)
+	if !white {
+		pieces = &(b.Black)
+	}
+	switch p {
+	case Pawn:
+		return pieces.Pawns
+	case Knight:
+		return pieces.Knights
+	case Bishop:
+		return pieces.Bishops
+	case Rook:
+		return pieces.Rooks
+	case Queen:
+		return pieces.Queens
+	case King:
+		return pieces.Kings
+	}
+	return 0
+}
+
 // Data stored inside, from LSB
 // 6 bits: destination square
 // 6 bits: source square
 // 3 bits: promotion
+// 1 bit: null move flag
 
 // Move bitwise structure; internal implementation is private.
 type Move uint16
 
+// The null move, which passes the turn without moving a piece (UCI "0000").
+// It is encoded with only the otherwise-unused top bit set, so it can never
+// collide with a real move, nor with the zero Move.
+const NullMove Move = 1 << 15
+
+// Whether this is the null move.
+func (m *Move) IsNull() bool {
+	return *m == NullMove
+}
+
 func (m *Move) To() uint8 {
 	return uint8(*m & 0x3F)
 }
@@ -158,6 +310,15 @@ func (m *Move) From() uint8 {
 func (m *Move) Promote() Piece {
 	return Piece((*m & 0x7000) >> 12)
 }
+
+// Returns the destination square if the move is a promotion. The second value is
+// false if it is not.
+func (m *Move) PromotionSquare() (Square, bool) {
+	if m.Promote() == Nothing {
+		return 0, false
+	}
+	return Square(m.To()), true
+}
 func (m *Move) Setto(s Square) *Move {
 	*m = *m & ^(Move(0x3F)) | Move(s)
 	return m
@@ -173,7 +334,9 @@ func (m *Move) Setpromote(p Piece) *Move {
 func (m *Move) String() string {
 	/*return fmt.Sprintf("[from: %v, to: %v, promote: %v]",
 	IndexToAlgebraic(Square(m.From())), IndexToAlgebraic(Square(m.To())), m.Promote())*/
-	if *m == 0 {
+	// Only the null move is written as "0000". The zero Move is written as
+	// "a1a1", so that it parses back as itself rather than as the null move.
+	if m.IsNull() {
 		return "0000"
 	}
 	result := IndexToAlgebraic(Square(m.From())) + IndexToAlgebraic(Square(m.To()))
@@ -206,3 +369,30 @@ const (
 	Queen   = iota
 	King    = iota
 )
+
+// A piece type together with its color.
+type ColoredPiece struct {
+	Piece Piece
+	White bool
+}
+
+// A set of piece types, with bit p set for each Piece p in the set.
+type PieceMask uint8
+
+const (
+	PawnMask   PieceMask = 1 << Pawn
+	KnightMask PieceMask = 1 << Knight
+	BishopMask PieceMask = 1 << Bishop
+	RookMask   PieceMask = 1 << Rook
+	QueenMask  PieceMask = 1 << Queen
+	KingMask   PieceMask = 1 << King
+	// Bishops, rooks and queens.
+	SliderMask = BishopMask | RookMask | QueenMask
+	// Every piece type.
+	AllPiecesMask = PawnMask | KnightMask | SliderMask | KingMask
+)
+
+// Whether the piece type is in the set.
+func (m PieceMask) Contains(p Piece) bool {
+	return m&(1<<p) != 0
+}
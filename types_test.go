@@ -0,0 +1,85 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestCastlingRightsRoundTrip(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if b.CastlingRights() != AllCastleRights {
+		t.Error("Wrong castling rights parsed. Got", b.CastlingRights())
+	}
+	for r := CastleRights(0); r <= AllCastleRights; r++ {
+		b.SetCastlingRights(r)
+		if b.CastlingRights() != r {
+			t.Error("Castling rights did not round trip. Set", r, "but got", b.CastlingRights())
+		}
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Setting castling rights", r, "produced an inconsistent hash.")
+		}
+	}
+	b.SetCastlingRights(WhiteKingside | BlackQueenside)
+	if b.ToFen() != "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w Kq - 0 0" {
+		t.Error("Wrong FEN after setting castling rights:", b.ToFen())
+	}
+}
+
+func TestSetCastlingRightsGeneration(t *testing.T) {
+	positions := map[CastleRights]int{
+		AllCastleRights:                48,
+		0:                              46,
+		WhiteKingside:                  47,
+		WhiteQueenside | BlackKingside: 47,
+	}
+	for k, v := range positions {
+		b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+		b.SetCastlingRights(k)
+		moves := b.GenerateLegalMoves()
+		if len(moves) != v {
+			t.Error("Legal moves with castling rights", k, ": wrong length. Expected", v,
+				"but got", len(moves))
+		}
+	}
+}
+
+func TestPieces(t *testing.T) {
+	b := ParseFen("4k3/1p4q1/2n5/r7/5B2/1N3b2/P5R1/3QK3 w - - 0 1")
+	expected := []struct {
+		piece   Piece
+		white   bool
+		squares uint64
+	}{
+		{Pawn, true, bitboardOf("a2")}, {Pawn, false, bitboardOf("b7")},
+		{Knight, true, bitboardOf("b3")}, {Knight, false, bitboardOf("c6")},
+		{Bishop, true, bitboardOf("f4")}, {Bishop, false, bitboardOf("f3")},
+		{Rook, true, bitboardOf("g2")}, {Rook, false, bitboardOf("a5")},
+		{Queen, true, bitboardOf("d1")}, {Queen, false, bitboardOf("g7")},
+		{King, true, bitboardOf("e1")}, {King, false, bitboardOf("e8")},
+		{Nothing, true, 0}, {Nothing, false, 0},
+	}
+	for _, e := range expected {
+		if pieces := b.Pieces(e.piece, e.white); pieces != e.squares {
+			t.Error("Wrong squares for piece", e.piece, "white:", e.white, "\nExpected", e.squares, "but got", pieces)
+		}
+	}
+	start := ParseFen(Startpos)
+	if start.Pieces(Pawn, true) != onlyRank[1] || start.Pieces(Pawn, false) != onlyRank[6] {
+		t.Error("Wrong pawn squares for the starting position.")
+	}
+}
+
+func TestPromotionSquare(t *testing.T) {
+	moves := map[string]string{
+		"e7e8q": "e8",
+		"b2a1n": "a1",
+		"e2e4":  "",
+		"e7e8":  "",
+	}
+	for uci, expected := range moves {
+		m := parseMove(uci)
+		s, ok := m.PromotionSquare()
+		if ok != (expected != "") || (ok && IndexToAlgebraic(s) != expected) {
+			t.Error("Wrong promotion square for", uci, "\nExpected", expected, "but got", s, ok)
+		}
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/bits"
+	"math/rand"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 func recomputeBoardHash(b *Board) uint64 {
@@ -39,12 +44,16 @@ func recomputeBoardHash(b *Board) uint64 {
 	return hash
 }
 
+// Whether the move captures a piece on the board, including en passant captures.
 func IsCapture(m Move, b *Board) bool {
 	toBitboard := (uint64(1) << m.To())
 	if (toBitboard&b.White.All != 0) || (toBitboard&b.Black.All != 0) {
 		return true
 	}
-	// Is it an en passant capture?
+	// Is it an en passant capture? (The square is 0 when there is no target.)
+	if b.enpassant == 0 {
+		return false
+	}
 	fromBitboard := (uint64(1) << m.From())
 	originIsPawn := fromBitboard&b.White.Pawns != 0 || fromBitboard&b.Black.Pawns != 0
 	return originIsPawn && (toBitboard&(uint64(1) << b.enpassant) != 0)
@@ -67,10 +76,11 @@ func (b *Bitboards) sanityCheck() {
 
 // Some example valid move strings:
 // e1e2 b4d6 e7e8q a2a1n
+// The UCI null move "0000" is parsed as NullMove.
 // TODO(dylhunn): Make the parser more forgiving. Eg: 0-0, O-O-O, a2-a3, D3D4
 func ParseMove(movestr string) (Move, error) {
 	if movestr == "0000" {
-		return 0, nil
+		return NullMove, nil
 	}
 	var mv Move
 	if len(movestr) < 4 || len(movestr) > 5 {
@@ -99,6 +109,109 @@ func ParseMove(movestr string) (Move, error) {
 	return mv, nil
 }
 
+// Writes a sequence of moves as space-separated UCI strings, as in "e2e4 e7e5 g1f3".
+func WriteUCILine(moves []Move) string {
+	uci := make([]string, len(moves))
+	for i := range moves {
+		uci[i] = moves[i].String()
+	}
+	return strings.Join(uci, " ")
+}
+
+// Parses a sequence of space-separated UCI moves played from the given position.
+// Each move is checked for legality on a copy of the board, which is advanced as
+// the moves are read; the board itself is unchanged. Null moves ("0000") are
+// accepted when the side to move is not in check.
+func ParseUCILine(b *Board, line string) ([]Move, error) {
+	position := b.detachedCopy()
+	return position.applyUCIMoves(strings.Fields(line))
+}
+
+// Reconstructs the board of a UCI "position" command: parses the FEN, or uses the
+// starting position if fen is "startpos", then applies each UCI move in turn,
+// checking that it is legal. The returned board has the en passant square, castling
+// rights and move clocks that result from the moves.
+func ApplyUCIPosition(fen string, uciMoves []string) (Board, error) {
+	if fen == "startpos" {
+		fen = Startpos
+	}
+	b, err := ParseFenSafe(fen)
+	if err != nil {
+		return Board{}, err
+	}
+	if _, err := b.applyUCIMoves(uciMoves); err != nil {
+		return Board{}, err
+	}
+	return b, nil
+}
+
+// Returns the FEN of the position reached by playing the UCI moves from the given
+// FEN (or "startpos"), checking each move for legality. This suits stateless
+// callers, such as web handlers, that are sent a position and moves and only need
+// the resulting position back.
+func AdvanceFEN(fen string, uciMoves []string) (string, error) {
+	b, err := ApplyUCIPosition(fen, uciMoves)
+	if err != nil {
+		return "", err
+	}
+	return b.ToFen(), nil
+}
+
+// Parses and applies UCI moves to the board, checking each for legality.
+func (b *Board) applyUCIMoves(tokens []string) ([]Move, error) {
+	var moves []Move
+	for _, token := range tokens {
+		m, err := ParseMove(token)
+		if err != nil {
+			return nil, err
+		}
+		if m.IsNull() && !b.OurKingInCheck() {
+			b.ApplyNullMove()
+		} else if b.isLegalMove(m) {
+			b.Apply(m)
+		} else {
+			return nil, errors.New("Illegal move in UCI line: " + token)
+		}
+		moves = append(moves, m)
+	}
+	return moves, nil
+}
+
+// Sorts moves into a canonical order, that of their UCI strings, so that move
+// lists from different sources can be compared.
+func SortMoves(moves []Move) {
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].String() < moves[j].String()
+	})
+}
+
+// Generates all legal moves, sorted by origin square, then destination square,
+// then promotion piece in the order knight, bishop, rook, queen.
+// Squares are compared by index, so a1 comes first and h8 last. Unlike that of
+// GenerateLegalMoves(), this order is guaranteed not to change between versions.
+func (b *Board) GenerateLegalMovesOrdered() []Move {
+	moves := b.GenerateLegalMoves()
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].From() != moves[j].From() {
+			return moves[i].From() < moves[j].From()
+		}
+		if moves[i].To() != moves[j].To() {
+			return moves[i].To() < moves[j].To()
+		}
+		return moves[i].Promote() < moves[j].Promote()
+	})
+	return moves
+}
+
+// Reorders moves randomly in place. The order depends only on the state of r, so
+// a seeded source gives a reproducible shuffle, for example to check that code
+// does not depend on the order of the generated moves.
+func ShuffleMoves(moves []Move, r *rand.Rand) {
+	r.Shuffle(len(moves), func(i, j int) {
+		moves[i], moves[j] = moves[j], moves[i]
+	})
+}
+
 func printBitboard(bitboard uint64) {
 	for i := 63; i >= 0; i-- {
 		j := (i/8)*8 + (7 - (i % 8))
@@ -151,6 +264,35 @@ func IndexToAlgebraic(id Square) string {
 	return fmt.Sprintf("%c", rune) + strconv.Itoa((int(id)/8)+1)
 }
 
+// Returns the number of king moves needed to travel between two squares on an
+// empty board (the Chebyshev distance).
+func KingDistance(a, b Square) int {
+	fileDistance, rankDistance := squareOffsets(a, b)
+	if fileDistance > rankDistance {
+		return fileDistance
+	}
+	return rankDistance
+}
+
+// Returns the sum of the file and rank distances between two squares.
+func ManhattanDistance(a, b Square) int {
+	fileDistance, rankDistance := squareOffsets(a, b)
+	return fileDistance + rankDistance
+}
+
+// Returns the absolute file and rank differences between two squares.
+func squareOffsets(a, b Square) (int, int) {
+	fileDistance := int(a%8) - int(b%8)
+	rankDistance := int(a/8) - int(b/8)
+	if fileDistance < 0 {
+		fileDistance = -fileDistance
+	}
+	if rankDistance < 0 {
+		rankDistance = -rankDistance
+	}
+	return fileDistance, rankDistance
+}
+
 // Serializes a board position to a Fen string.
 func (b *Board) ToFen() string {
 	b.White.sanityCheck()
@@ -215,26 +357,7 @@ func (b *Board) ToFen() string {
 		position += " b"
 	}
 	position += " "
-	castleCount := 0
-	if b.whiteCanCastleKingside() {
-		position += "K"
-		castleCount++
-	}
-	if b.whiteCanCastleQueenside() {
-		position += "Q"
-		castleCount++
-	}
-	if b.blackCanCastleKingside() {
-		position += "k"
-		castleCount++
-	}
-	if b.blackCanCastleQueenside() {
-		position += "q"
-		castleCount++
-	}
-	if castleCount == 0 {
-		position += "-"
-	}
+	position += b.castlingField()
 	position += " "
 	if b.enpassant != 0 {
 		position += IndexToAlgebraic(Square(b.enpassant))
@@ -245,7 +368,224 @@ func (b *Board) ToFen() string {
 	return position
 }
 
+// Parse a board from a FEN string, validating it first. Returns an error if the
+// FEN is malformed, or if either side does not have exactly one king.
+// The castling field may name rook files (Shredder-FEN and X-FEN), as for Chess960;
+// these are kept so that ToFen() writes them back.
+func ParseFenSafe(fen string) (Board, error) {
+	tokens := strings.Fields(fen)
+	if len(tokens) < 4 || len(tokens) > 6 {
+		return Board{}, errors.New("FEN must have between 4 and 6 fields: " + fen)
+	}
+	ranks := strings.Split(tokens[0], "/")
+	if len(ranks) != 8 {
+		return Board{}, errors.New("FEN must have 8 ranks: " + fen)
+	}
+	for _, rank := range ranks {
+		squares := 0
+		for _, c := range rank {
+			if c >= '1' && c <= '8' {
+				squares += int(c - '0')
+			} else if strings.ContainsRune("pnbrqkPNBRQK", c) {
+				squares++
+			} else {
+				return Board{}, errors.New("Invalid piece in FEN: " + string(c))
+			}
+		}
+		if squares != 8 {
+			return Board{}, errors.New("FEN rank does not have 8 squares: " + rank)
+		}
+	}
+	if strings.Count(tokens[0], "K") != 1 || strings.Count(tokens[0], "k") != 1 {
+		return Board{}, errors.New("FEN must have exactly one king per side: " + fen)
+	}
+	if tokens[1] != "w" && tokens[1] != "b" {
+		return Board{}, errors.New("Invalid side to move in FEN: " + tokens[1])
+	}
+	if tokens[3] != "-" {
+		if len(tokens[3]) != 2 || (tokens[3][1] != '3' && tokens[3][1] != '6') {
+			return Board{}, errors.New("Invalid en passant square in FEN: " + tokens[3])
+		}
+		if _, err := AlgebraicToIndex(tokens[3]); err != nil {
+			return Board{}, errors.New("Invalid en passant square in FEN: " + tokens[3])
+		}
+	}
+	if len(tokens) > 4 {
+		if clock, err := strconv.Atoi(tokens[4]); err != nil || clock < 0 || clock > 255 {
+			return Board{}, errors.New("Invalid halfmove clock in FEN: " + tokens[4])
+		}
+	}
+	if len(tokens) > 5 {
+		if moveno, err := strconv.Atoi(tokens[5]); err != nil || moveno < 0 || moveno > 65535 {
+			return Board{}, errors.New("Invalid fullmove number in FEN: " + tokens[5])
+		}
+	}
+	b := ParseFen(fen)
+	if _, _, err := parseCastlingField(tokens[2], &b); err != nil {
+		return Board{}, err
+	}
+	return b, nil
+}
+
+// Inputs shorter than this are validated by ValidateFENs() without starting workers.
+const parallelValidationThreshold = 256
+
+// Validates many FEN strings, with ParseFenSafe() and then IsValidPosition().
+// The returned slice parallels the input: each entry is nil if that FEN is valid,
+// and the error otherwise. Large inputs are split among one worker per CPU.
+func ValidateFENs(fens []string) []error {
+	errs := make([]error, len(fens))
+	validate := func(i int) {
+		b, err := ParseFenSafe(fens[i])
+		if err == nil {
+			_, err = b.IsValidPosition()
+		}
+		errs[i] = err
+	}
+	if len(fens) < parallelValidationThreshold {
+		for i := range fens {
+			validate(i)
+		}
+		return errs
+	}
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(fens); i += workers {
+				validate(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return errs
+}
+
+// How the en passant field of a FEN is interpreted by ParseFenWithEnPassant().
+type EnPassantConvention int
+
+const (
+	// The en passant field holds the square a capturing pawn lands on, as in standard FEN.
+	EnPassantAsLandingSquare EnPassantConvention = iota
+	// The en passant field holds the square of the pawn that can be captured.
+	EnPassantAsPawnSquare
+)
+
+// Parses and validates a FEN string like ParseFenSafe(), interpreting the en passant
+// field according to the given convention, for interoperating with tools that
+// write the captured pawn's square instead of the landing square. The board always
+// stores the landing square, so ToFen() writes standard FEN.
+func ParseFenWithEnPassant(fen string, convention EnPassantConvention) (Board, error) {
+	tokens := strings.Fields(fen)
+	if convention == EnPassantAsPawnSquare && len(tokens) >= 4 && tokens[3] != "-" {
+		pawn, err := AlgebraicToIndex(tokens[3])
+		if err != nil {
+			return Board{}, errors.New("Invalid en passant square in FEN: " + tokens[3])
+		}
+		switch pawn / 8 {
+		case 3: // a white pawn on the fourth rank
+			tokens[3] = IndexToAlgebraic(Square(pawn - 8))
+		case 4: // a black pawn on the fifth rank
+			tokens[3] = IndexToAlgebraic(Square(pawn + 8))
+		default:
+			return Board{}, errors.New("Invalid en passant pawn square in FEN: " + tokens[3])
+		}
+	}
+	return ParseFenSafe(strings.Join(tokens, " "))
+}
+
+// Parses the castling field of a FEN, which may use the standard KQkq letters, or
+// the file letters of the castling rooks (A-H for white, a-h for black) as in
+// Shredder-FEN and X-FEN for Chess960. A rook file on the king's side of the board
+// is a kingside right. Returns the rights, and for each right named by a file,
+// that file plus one. The board must already have its pieces in place.
+func parseCastlingField(field string, b *Board) (CastleRights, [4]uint8, error) {
+	var rights CastleRights
+	var files [4]uint8
+	if field == "-" {
+		return rights, files, nil
+	}
+	for _, c := range field {
+		var right CastleRights
+		var file uint8
+		switch {
+		case c == 'K':
+			right = WhiteKingside
+		case c == 'Q':
+			right = WhiteQueenside
+		case c == 'k':
+			right = BlackKingside
+		case c == 'q':
+			right = BlackQueenside
+		case c >= 'A' && c <= 'H':
+			file = uint8(c-'A') + 1
+			right = WhiteQueenside
+		case c >= 'a' && c <= 'h':
+			file = uint8(c-'a') + 1
+			right = BlackQueenside
+		default:
+			return 0, files, errors.New("Invalid castling rights in FEN: " + field)
+		}
+		if file != 0 {
+			pieces, backRank := &(b.White), onlyRank[0]
+			if right == BlackQueenside {
+				pieces, backRank = &(b.Black), onlyRank[7]
+			}
+			king := Square(bits.TrailingZeros64(pieces.Kings & backRank))
+			if king == 64 || pieces.Rooks&backRank&onlyFile[file-1] == 0 || uint8(king%8) == file-1 {
+				return 0, files, errors.New("Castling rook file does not match the position: " + field)
+			}
+			if uint8(king%8) < file-1 {
+				right <<= 1 // the kingside right directly follows the queenside right
+			}
+			files[bits.TrailingZeros8(uint8(right))] = file
+		}
+		if rights&right != 0 {
+			return 0, files, errors.New("Duplicate castling rights in FEN: " + field)
+		}
+		rights |= right
+	}
+	return rights, files, nil
+}
+
+// Serializes the castling rights for a FEN, in the order K, Q, k, q. Rights that
+// were parsed from a rook file letter are written with the same letter.
+func (b *Board) castlingField() string {
+	var field string
+	for _, r := range [...]CastleRights{WhiteKingside, WhiteQueenside, BlackKingside, BlackQueenside} {
+		if CastleRights(b.castlerights)&r == 0 {
+			continue
+		}
+		var letter byte
+		switch r {
+		case WhiteKingside:
+			letter = 'K'
+		case WhiteQueenside:
+			letter = 'Q'
+		case BlackKingside:
+			letter = 'k'
+		case BlackQueenside:
+			letter = 'q'
+		}
+		if file := b.castleFiles[bits.TrailingZeros8(uint8(r))]; file != 0 {
+			if r&(WhiteKingside|WhiteQueenside) != 0 {
+				letter = 'A' + file - 1
+			} else {
+				letter = 'a' + file - 1
+			}
+		}
+		field += string(letter)
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
 // Parse a board from a FEN string.
+// For untrusted input, use ParseFenSafe() instead.
 func ParseFen(fen string) Board {
 	// BUG(dylhunn): This FEN parsing implementation doesn't handle malformed inputs.
 	tokens := strings.Fields(fen)
@@ -301,17 +641,23 @@ func ParseFen(fen string) Board {
 	b.Black.All = b.Black.Pawns | b.Black.Knights | b.Black.Bishops | b.Black.Rooks | b.Black.Queens | b.Black.Kings
 
 	b.Wtomove = tokens[1] == "w" || tokens[1] == "W"
-	if strings.Contains(tokens[2], "K") {
-		b.flipWhiteKingsideCastle()
-	}
-	if strings.Contains(tokens[2], "Q") {
-		b.flipWhiteQueensideCastle()
-	}
-	if strings.Contains(tokens[2], "k") {
-		b.flipBlackKingsideCastle()
-	}
-	if strings.Contains(tokens[2], "q") {
-		b.flipBlackQueensideCastle()
+	if rights, files, err := parseCastlingField(tokens[2], &b); err == nil {
+		b.castlerights = uint8(rights)
+		b.castleFiles = files
+	} else {
+		// Keep whichever standard rights can still be read from a malformed field.
+		if strings.Contains(tokens[2], "K") {
+			b.flipWhiteKingsideCastle()
+		}
+		if strings.Contains(tokens[2], "Q") {
+			b.flipWhiteQueensideCastle()
+		}
+		if strings.Contains(tokens[2], "k") {
+			b.flipBlackKingsideCastle()
+		}
+		if strings.Contains(tokens[2], "q") {
+			b.flipBlackQueensideCastle()
+		}
 	}
 	if tokens[3] != "-" {
 		res, err := AlgebraicToIndex(tokens[3])
@@ -332,5 +678,144 @@ func ParseFen(fen string) Board {
 		b.Fullmoveno = uint16(result)
 	}
 	b.hash = recomputeBoardHash(&b)
+	b.material = int16(b.Material())
 	return b
 }
+
+// Constructs a board from a map of squares to pieces, without going through a FEN.
+// The side to move is white if whiteToMove is set, and ep is the en passant square
+// in FEN terms, or 0 if there is none. The clocks are set for the start of a game.
+// Returns an error if a piece is invalid, or if IsValidPosition() rejects the result.
+func NewBoardFromPieces(pieces map[Square]ColoredPiece, whiteToMove bool, rights CastleRights, ep Square) (Board, error) {
+	var b Board
+	for s, p := range pieces {
+		if s > 63 {
+			return Board{}, errors.New("Invalid square: " + strconv.Itoa(int(s)))
+		}
+		side := &(b.White)
+		if !p.White {
+			side = &(b.Black)
+		}
+		mask := uint64(1) << s
+		switch p.Piece {
+		case Pawn:
+			side.Pawns |= mask
+		case Knight:
+			side.Knights |= mask
+		case Bishop:
+			side.Bishops |= mask
+		case Rook:
+			side.Rooks |= mask
+		case Queen:
+			side.Queens |= mask
+		case King:
+			side.Kings |= mask
+		default:
+			return Board{}, errors.New("Invalid piece on " + IndexToAlgebraic(s))
+		}
+		side.All |= mask
+	}
+	if ep > 63 {
+		return Board{}, errors.New("Invalid en passant square: " + strconv.Itoa(int(ep)))
+	}
+	b.Wtomove = whiteToMove
+	b.castlerights = uint8(rights & AllCastleRights)
+	b.enpassant = uint8(ep)
+	b.Fullmoveno = 1
+	if _, err := b.IsValidPosition(); err != nil {
+		return Board{}, err
+	}
+	b.hash = recomputeBoardHash(&b)
+	b.material = int16(b.Material())
+	return b, nil
+}
+
+// Renders the board as an ASCII diagram: eight rows of eight squares, from rank 8
+// down to rank 1, using FEN piece letters and '.' for empty squares. A final line
+// holds the remaining FEN fields (side to move, castling, en passant and clocks).
+func (b *Board) String() string {
+	fields := strings.Fields(b.ToFen())
+	var diagram string
+	for _, rank := range strings.Split(fields[0], "/") {
+		for _, c := range rank {
+			if c >= '1' && c <= '8' {
+				diagram += strings.Repeat(".", int(c-'0'))
+			} else {
+				diagram += string(c)
+			}
+		}
+		diagram += "\n"
+	}
+	return diagram + strings.Join(fields[1:], " ") + "\n"
+}
+
+// Parses a board from an ASCII diagram, in the format produced by Board.String().
+// Whitespace between squares is ignored. If the info line with the remaining FEN
+// fields is omitted, white is to move, with no castling rights or en passant square.
+func ParseDiagram(s string) (Board, error) {
+	var rows []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			rows = append(rows, line)
+		}
+	}
+	if len(rows) != 8 && len(rows) != 9 {
+		return Board{}, errors.New("Diagram must have 8 board rows and an optional info line.")
+	}
+	var placement []string
+	for _, row := range rows[:8] {
+		row = strings.Join(strings.Fields(row), "")
+		if len(row) != 8 {
+			return Board{}, errors.New("Diagram row does not have 8 squares: " + row)
+		}
+		var fenRank string
+		empty := 0
+		for _, c := range row {
+			if c == '.' {
+				empty++
+				continue
+			}
+			if !strings.ContainsRune("pnbrqkPNBRQK", c) {
+				return Board{}, errors.New("Invalid piece in diagram: " + string(c))
+			}
+			if empty != 0 {
+				fenRank += strconv.Itoa(empty)
+				empty = 0
+			}
+			fenRank += string(c)
+		}
+		if empty != 0 {
+			fenRank += strconv.Itoa(empty)
+		}
+		placement = append(placement, fenRank)
+	}
+	info := "w - - 0 1"
+	if len(rows) == 9 {
+		info = rows[8]
+	}
+	infoFields := strings.Fields(info)
+	if len(infoFields) < 3 || len(infoFields) > 5 {
+		return Board{}, errors.New("Invalid diagram info line: " + info)
+	}
+	if infoFields[0] != "w" && infoFields[0] != "b" {
+		return Board{}, errors.New("Invalid side to move in diagram: " + infoFields[0])
+	}
+	if strings.Trim(infoFields[1], "KQkqABCDEFGHabcdefgh") != "" && infoFields[1] != "-" {
+		return Board{}, errors.New("Invalid castling rights in diagram: " + infoFields[1])
+	}
+	if infoFields[2] != "-" {
+		if len(infoFields[2]) != 2 {
+			return Board{}, errors.New("Invalid en passant square in diagram: " + infoFields[2])
+		}
+		if _, err := AlgebraicToIndex(infoFields[2]); err != nil {
+			return Board{}, errors.New("Invalid en passant square in diagram: " + infoFields[2])
+		}
+	}
+	for _, clock := range infoFields[3:] {
+		if _, err := strconv.Atoi(clock); err != nil {
+			return Board{}, errors.New("Invalid move clock in diagram: " + clock)
+		}
+	}
+	return ParseFenSafe(strings.Join(placement, "/") + " " + info)
+}
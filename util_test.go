@@ -1,6 +1,8 @@
 package dragontoothmg
 
 import (
+	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -21,6 +23,28 @@ func TestParseMove(t *testing.T) {
 	}
 }
 
+func TestIsCapture(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected bool
+	}{
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "e4d5", true},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "e4e5", false},
+		{"4k3/5p2/8/3Pp3/8/8/8/4K3 w - e6 0 1", "d5e6", true},
+		{"4k3/5p2/8/3Pp3/8/8/8/4K3 w - e6 0 1", "d5d6", false},
+		// without an en passant target, a pawn reaching a1 is not a capture
+		{"4k3/8/8/8/8/8/p7/4K3 b - - 0 1", "a2a1q", false},
+		{"4k3/8/8/8/8/8/p7/1N2K3 b - - 0 1", "a2b1q", true},
+	}
+	for _, test := range tests {
+		b := ParseFen(test.fen)
+		if res := IsCapture(parseMove(test.move), &b); res != test.expected {
+			t.Error("Wrong capture result for", test.move, "in", test.fen, "\nExpected", test.expected, "but got", res)
+		}
+	}
+}
+
 func TestAlgToIdx(t *testing.T) {
 	if algebraicToIndexFatal("A8") != 56 {
 		t.Error("Algebraic to index conversion failed.")
@@ -116,3 +140,550 @@ func TestToFen(t *testing.T) {
 		}
 	}
 }
+
+func TestDiagramRoundTrip(t *testing.T) {
+	fenTests := []string{
+		"1Q2rk2/2p2p2/1n4b1/N7/2B1Pp1q/2B4P/1QPP4/4K2R b K e3 4 30",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+	}
+	for _, fen := range fenTests {
+		b := ParseFen(fen)
+		parsed, err := ParseDiagram(b.String())
+		if err != nil {
+			t.Error("Failed to parse diagram for", fen, ":", err)
+			continue
+		}
+		if parsed.ToFen() != fen {
+			t.Error("Diagram round trip failed.\nOutput:  ", parsed.ToFen(), "\nExpected:", fen)
+		}
+		if parsed.Hash() != b.Hash() {
+			t.Error("Diagram round trip changed the hash for", fen)
+		}
+	}
+}
+
+func TestParseDiagram(t *testing.T) {
+	diagram := `
+		r . . . k . . r
+		. . . . . . . .
+		. . . . . . . .
+		. . . . . . . .
+		. . . . . . . .
+		. . . . . . . .
+		. . . . . . . .
+		R . . . K . . R
+	`
+	b, err := ParseDiagram(diagram)
+	if err != nil {
+		t.Error("Failed to parse diagram:", err)
+	}
+	if b.ToFen() != "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1" {
+		t.Error("Wrong position parsed from diagram:", b.ToFen())
+	}
+	invalid := []string{
+		"rnbqkbnr\npppppppp\n........\n",
+		"rnbqkbnr\npppppppp\n........\n........\n........\n........\nPPPPPPPP\nRNBQKBN\n",
+		"rnbqkbnr\npppppppp\n........\n........\n........\n........\nPPPPPPPP\nRNBQKBNX\n",
+		"rnbqkbnr\npppppppp\n........\n........\n........\n........\nPPPPPPPP\nRNBQKBNR\nx KQkq - 0 1\n",
+		"rnbqkbnr\npppppppp\n........\n........\n........\n........\nPPPPPPPP\nRNBQKBNR\nw KQkq z9 0 1\n",
+		"rnbqkbnr\npppppppp\n........\n........\n........\n........\nPPPPPPPP\nRNBQKBNR\nw KQkq e 0 1\n",
+		"rnbqkbnr\npppppppp\n........\n........\n........\n........\nPPPPPPPP\nRNBQKBNR\nw GBgb - 0 1\n",
+	}
+	for _, d := range invalid {
+		if _, err := ParseDiagram(d); err == nil {
+			t.Error("Parsed an invalid diagram without error:\n", d)
+		}
+	}
+}
+
+func TestParseFenSafe(t *testing.T) {
+	valid := []string{
+		"1Q2rk2/2p2p2/1n4b1/N7/2B1Pp1q/2B4P/1QPP4/4K2R b K e3 4 30",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -",
+	}
+	for _, fen := range valid {
+		b, err := ParseFenSafe(fen)
+		if err != nil {
+			t.Error("Failed to parse valid FEN", fen, ":", err)
+		}
+		expected := ParseFen(fen)
+		if b.ToFen() != expected.ToFen() {
+			t.Error("ParseFenSafe disagrees with ParseFen for", fen)
+		}
+	}
+	invalid := []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/7/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqqbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkx - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KKkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e4 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - x 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 300 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 -1",
+	}
+	for _, fen := range invalid {
+		if _, err := ParseFenSafe(fen); err == nil {
+			t.Error("Parsed an invalid FEN without error:", fen)
+		}
+	}
+}
+
+func TestNullMove(t *testing.T) {
+	move, err := ParseMove("0000")
+	if err != nil || move != NullMove || !move.IsNull() {
+		t.Error("Failed to parse the null move.")
+	}
+	if move.String() != "0000" {
+		t.Error("Null move did not round trip. Got", move.String())
+	}
+	var zero Move
+	if zero.IsNull() || zero == NullMove {
+		t.Error("The zero move should be distinct from the null move.")
+	}
+	if zero.String() != "a1a1" {
+		t.Error("Wrong string for the zero move\nExpected a1a1 but got", zero.String())
+	}
+	if parsed, err := ParseMove(zero.String()); err != nil || parsed != zero || parsed.IsNull() {
+		t.Error("The zero move did not round trip. Got", &parsed)
+	}
+	// no legal move can be the null move
+	for _, fen := range []string{Startpos, "n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0"} {
+		b := ParseFen(fen)
+		for _, m := range b.GenerateLegalMoves() {
+			if m.IsNull() {
+				t.Error("A legal move was reported as the null move:", &m)
+			}
+		}
+	}
+}
+
+func TestChess960CastlingFen(t *testing.T) {
+	// Shredder-FEN and X-FEN castling fields survive a round trip unchanged.
+	fens := []string{
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9",
+		"1rqbkrbn/1ppppp1p/1n6/p1N3p1/8/2P4P/PP1PPPP1/1RQBKRBN w FBfb - 0 9",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w Kq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w Ha - 0 1",
+	}
+	for _, fen := range fens {
+		b, err := ParseFenSafe(fen)
+		if err != nil {
+			t.Error("Failed to parse Chess960 FEN", fen, ":", err)
+			continue
+		}
+		if b.ToFen() != fen {
+			t.Error("Chess960 FEN did not round trip.\nExpected", fen, "but got", b.ToFen())
+		}
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Inconsistent hash for", fen)
+		}
+	}
+	// Non-standard castling is never generated, so the moves match the same
+	// positions without castling rights.
+	for _, fen := range fens[:3] {
+		b := ParseFen(fen)
+		fields := strings.Fields(fen)
+		fields[2] = "-"
+		noCastling := ParseFen(strings.Join(fields, " "))
+		if len(b.GenerateLegalMoves()) != len(noCastling.GenerateLegalMoves()) {
+			t.Error("Generated castling moves with non-standard geometry for", fen)
+		}
+	}
+	// file letters naming the standard rooks castle like KQkq
+	kiwipete := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w HAha - 0 1")
+	if moves := kiwipete.GenerateLegalMoves(); len(moves) != 48 {
+		t.Error("Wrong number of moves with rook file castling rights:", len(moves))
+	}
+	if kiwipete.CastlingRights() != AllCastleRights {
+		t.Error("Rook file letters were not parsed as all castling rights.")
+	}
+	frc, _ := ParseFenSafe("bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9")
+	if frc.CastlingRights() != AllCastleRights {
+		t.Error("Chess960 castling rights were parsed incorrectly:", frc.CastlingRights())
+	}
+	invalid := []string{
+		// no rook on the named file
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w GFhf - 2 9",
+		// the king's own file
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HGhf - 2 9",
+		// two kingside rights for white
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HKhf - 2 9",
+	}
+	for _, fen := range invalid {
+		if _, err := ParseFenSafe(fen); err == nil {
+			t.Error("Parsed invalid Chess960 castling rights without error:", fen)
+		}
+	}
+	// ParseFen still reads each standard letter of a malformed field on its own
+	malformed := map[string]CastleRights{
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkqX - 0 1": AllCastleRights,
+		"r3k2r/8/8/8/8/8/8/R3K2R w KKq - 0 1":   WhiteKingside | BlackQueenside,
+		"r3k2r/8/8/8/8/8/8/R3K2R w Kqc - 0 1":   WhiteKingside | BlackQueenside,
+	}
+	for fen, expected := range malformed {
+		b := ParseFen(fen)
+		if b.CastlingRights() != expected {
+			t.Error("Wrong castling rights for malformed field in", fen, "\nExpected", expected, "but got", b.CastlingRights())
+		}
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Inconsistent hash for", fen)
+		}
+	}
+}
+
+func TestChess960CastlingRightsLost(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected string
+	}{
+		// the g1 rook leaves its home square
+		{"1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3KR1 w GBgb - 0 1", "g1h1", "1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3K1R b Bgb - 1 1"},
+		{"1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3KR1 w GBgb - 0 1", "b1a1", "1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/R4KR1 b Ggb - 1 1"},
+		// the g1 rook captures the g8 rook, so both lose their rights
+		{"1r3kr1/pppppp1p/8/8/8/8/PPPPPP1P/1R3KR1 w GBgb - 0 1", "g1g8", "1r3kR1/pppppp1p/8/8/8/8/PPPPPP1P/1R3K2 b Bb - 0 1"},
+	}
+	for _, test := range tests {
+		b, err := ParseFenSafe(test.fen)
+		if err != nil {
+			t.Error("Failed to parse Chess960 FEN", test.fen, ":", err)
+			continue
+		}
+		m := parseMove(test.move)
+		rightsAfter := b.CastlingRightsAfter(m)
+		unapply := b.Apply(m)
+		if fen := b.ToFen(); fen != test.expected {
+			t.Error("Wrong FEN after", test.move, "in", test.fen, "\nExpected", test.expected, "but got", fen)
+		}
+		if b.CastlingRights() != rightsAfter {
+			t.Error("CastlingRightsAfter disagrees with Apply for", test.move, "in", test.fen)
+		}
+		if b.Hash() != recomputeBoardHash(&b) {
+			t.Error("Inconsistent hash after", test.move, "in", test.fen)
+		}
+		reparsed, err := ParseFenSafe(b.ToFen())
+		if err != nil {
+			t.Error("Failed to reparse the FEN after", test.move, "in", test.fen, ":", err)
+		} else if reparsed.ToFen() != b.ToFen() {
+			t.Error("FEN after", test.move, "did not round trip\nExpected", b.ToFen(), "but got", reparsed.ToFen())
+		}
+		unapply()
+		if b.ToFen() != test.fen {
+			t.Error("Unapplying", test.move, "did not restore the castling rights\nExpected", test.fen, "but got", b.ToFen())
+		}
+		_, undo := b.ApplyWithUndo(m)
+		b.Unapply(m, undo)
+		if b.ToFen() != test.fen {
+			t.Error("Unapply of", test.move, "did not restore the castling rights\nExpected", test.fen, "but got", b.ToFen())
+		}
+	}
+}
+
+func TestEnPassantConventions(t *testing.T) {
+	// after 1. e4, and after 1. e4 d5 2. e5 f5
+	positions := map[string][2]string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1":   {"e3", "e4"},
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3": {"f6", "f5"},
+	}
+	for fen, squares := range positions {
+		b := ParseFen(fen)
+		landing, ok := b.EnPassantSquare()
+		if !ok || IndexToAlgebraic(landing) != squares[0] {
+			t.Error("Wrong en passant landing square for", fen, ":", IndexToAlgebraic(landing))
+		}
+		pawn, ok := b.EnPassantPawnSquare()
+		if !ok || IndexToAlgebraic(pawn) != squares[1] {
+			t.Error("Wrong en passant pawn square for", fen, ":", IndexToAlgebraic(pawn))
+		}
+		// the same position, written with the captured pawn's square
+		fields := strings.Fields(fen)
+		fields[3] = squares[1]
+		parsed, err := ParseFenWithEnPassant(strings.Join(fields, " "), EnPassantAsPawnSquare)
+		if err != nil || parsed.ToFen() != fen {
+			t.Error("Failed to parse the en passant pawn square convention for", fen, ":", err)
+		}
+		parsed, err = ParseFenWithEnPassant(fen, EnPassantAsLandingSquare)
+		if err != nil || parsed.ToFen() != fen {
+			t.Error("Failed to parse the en passant landing square convention for", fen, ":", err)
+		}
+		if _, err := ParseFenWithEnPassant(fen, EnPassantAsPawnSquare); err == nil {
+			t.Error("Accepted a landing square as an en passant pawn square for", fen)
+		}
+	}
+	b := ParseFen(Startpos)
+	if _, ok := b.EnPassantSquare(); ok {
+		t.Error("Found an en passant square in the starting position.")
+	}
+	if _, ok := b.EnPassantPawnSquare(); ok {
+		t.Error("Found an en passant pawn square in the starting position.")
+	}
+	// a double push sets the square
+	b.Apply(parseMove("d2d4"))
+	if s, ok := b.EnPassantPawnSquare(); !ok || IndexToAlgebraic(s) != "d4" {
+		t.Error("Wrong en passant pawn square after a double push.")
+	}
+}
+
+func TestSquareDistances(t *testing.T) {
+	// king distance, then manhattan distance
+	distances := map[[2]string][2]int{
+		{"a1", "a1"}: {0, 0},
+		{"a1", "h8"}: {7, 14},
+		{"h1", "a8"}: {7, 14},
+		{"a1", "h1"}: {7, 7},
+		{"a8", "a1"}: {7, 7},
+		{"e4", "d5"}: {1, 2},
+		{"e4", "e5"}: {1, 1},
+		{"d4", "e5"}: {1, 2},
+		{"h4", "a5"}: {7, 8},
+		{"e4", "g7"}: {3, 5},
+		{"b2", "g3"}: {5, 6},
+	}
+	for squares, v := range distances {
+		a := Square(algebraicToIndexFatal(squares[0]))
+		b := Square(algebraicToIndexFatal(squares[1]))
+		if d := KingDistance(a, b); d != v[0] {
+			t.Error("Wrong king distance between", squares, "\nExpected", v[0], "but got", d)
+		}
+		if d := KingDistance(b, a); d != v[0] {
+			t.Error("King distance is not symmetric for", squares)
+		}
+		if d := ManhattanDistance(a, b); d != v[1] {
+			t.Error("Wrong manhattan distance between", squares, "\nExpected", v[1], "but got", d)
+		}
+	}
+}
+
+func TestUCILine(t *testing.T) {
+	lines := map[string]string{
+		Startpos: "e2e4 e7e5 g1f3 b8c6 f1c4 g8f6 e1g1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1":                              "g2g1n e2e3 d7e6 b7a8q",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1": "e8c8 0000 h3g2",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3":        "e5f6",
+	}
+	for fen, line := range lines {
+		b := ParseFen(fen)
+		moves, err := ParseUCILine(&b, line)
+		if err != nil {
+			t.Error("Failed to parse UCI line", line, ":", err)
+			continue
+		}
+		if written := WriteUCILine(moves); written != line {
+			t.Error("UCI line did not round trip.\nExpected", line, "but got", written)
+		}
+		if original := ParseFen(fen); b.ToFen() != original.ToFen() {
+			t.Error("Parsing a UCI line modified the board.")
+		}
+	}
+	b := ParseFen(Startpos)
+	if moves, err := ParseUCILine(&b, "  "); err != nil || len(moves) != 0 {
+		t.Error("Parsing an empty UCI line should produce no moves.")
+	}
+	invalid := []string{"e2e5", "e2e4 e2e4", "e2e4 e7e5 e1g1", "e2e4 x"}
+	for _, line := range invalid {
+		if _, err := ParseUCILine(&b, line); err == nil {
+			t.Error("Parsed an invalid UCI line without error:", line)
+		}
+	}
+}
+
+func TestShuffleMoves(t *testing.T) {
+	b := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	original := b.GenerateLegalMoves()
+	first := append([]Move(nil), original...)
+	second := append([]Move(nil), original...)
+	ShuffleMoves(first, rand.New(rand.NewSource(7)))
+	ShuffleMoves(second, rand.New(rand.NewSource(7)))
+	if WriteUCILine(first) != WriteUCILine(second) {
+		t.Error("Shuffles with the same seed differ.")
+	}
+	if WriteUCILine(first) == WriteUCILine(original) {
+		t.Error("Shuffle did not reorder the moves.")
+	}
+	SortMoves(first)
+	SortMoves(original)
+	if WriteUCILine(first) != WriteUCILine(original) {
+		t.Error("Shuffle is not a permutation of the moves.")
+	}
+	ShuffleMoves(nil, rand.New(rand.NewSource(7)))
+}
+
+func TestApplyUCIPosition(t *testing.T) {
+	tests := []struct {
+		fen      string
+		moves    []string
+		expected string
+	}{
+		{"startpos", nil, Startpos},
+		{"startpos", []string{"e2e4"}, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"},
+		{"startpos", []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "g8f6", "e1g1"},
+			"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 b kq - 5 4"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", []string{"e8c8", "e1g1"},
+			"2kr3r/8/8/8/8/8/8/R4RK1 b - - 2 2"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1", []string{"g2g1n", "e2e3", "d7e6", "b7a8q"},
+			"Q1n5/P1P5/4k3/8/8/4K3/5p1p/5NnN b - - 0 3"},
+	}
+	for _, test := range tests {
+		b, err := ApplyUCIPosition(test.fen, test.moves)
+		if err != nil {
+			t.Error("Failed to apply UCI position", test.fen, test.moves, ":", err)
+			continue
+		}
+		if fen := b.ToFen(); fen != test.expected {
+			t.Error("Wrong board after UCI position", test.fen, test.moves, "\nExpected", test.expected, "but got", fen)
+		}
+	}
+	invalid := []struct {
+		fen   string
+		moves []string
+	}{
+		{"startpos", []string{"e2e5"}},
+		{"startpos", []string{"e2e4", "e7e5", "e1g1"}},
+		{"startpos", []string{"e2e4", "x"}},
+		{"not a fen", nil},
+	}
+	for _, test := range invalid {
+		if _, err := ApplyUCIPosition(test.fen, test.moves); err == nil {
+			t.Error("Applied an invalid UCI position without error:", test.fen, test.moves)
+		}
+	}
+}
+
+func TestAdvanceFEN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		moves    []string
+		expected string
+	}{
+		{"startpos", []string{"d2d4", "d7d5", "c2c4"}, "rnbqkbnr/ppp1pppp/8/3p4/2PP4/8/PP2PPPP/RNBQKBNR b KQkq c3 0 2"},
+		{"8/2P2k2/8/8/8/8/5K2/8 w - - 0 1", []string{"c7c8q", "f7e7"}, "2Q5/4k3/8/8/8/8/5K2/8 w - - 1 2"},
+	}
+	for _, test := range tests {
+		fen, err := AdvanceFEN(test.fen, test.moves)
+		if err != nil {
+			t.Error("Failed to advance", test.fen, test.moves, ":", err)
+		} else if fen != test.expected {
+			t.Error("Wrong FEN after", test.fen, test.moves, "\nExpected", test.expected, "but got", fen)
+		}
+	}
+	if fen, err := AdvanceFEN("startpos", []string{"e2e4", "e2e4"}); err == nil {
+		t.Error("Advanced past an illegal move without error, got", fen)
+	}
+}
+
+func TestValidateFENs(t *testing.T) {
+	fens := []string{
+		Startpos,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 extra",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		// black is in check with white to move
+		"4k3/8/8/8/Q7/8/8/4K3 w - - 0 1",
+		"not a fen",
+		// the h8 rook is missing
+		"rnbqkbn1/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	}
+	valid := []bool{true, false, true, false, false, false}
+	check := func(errs []error, n int) {
+		if len(errs) != n {
+			t.Error("Wrong number of validation results. Expected", n, "but got", len(errs))
+			return
+		}
+		for i, err := range errs {
+			if (err == nil) != valid[i%len(valid)] {
+				t.Error("Wrong validation result for", fens[i%len(fens)], ":", err)
+			}
+		}
+	}
+	check(ValidateFENs(fens), len(fens))
+	// enough positions to use the worker pool
+	var many []string
+	for len(many) < 4*parallelValidationThreshold {
+		many = append(many, fens...)
+	}
+	check(ValidateFENs(many), len(many))
+	if errs := ValidateFENs(nil); len(errs) != 0 {
+		t.Error("Validating no FENs should produce no results.")
+	}
+}
+
+func TestNewBoardFromPieces(t *testing.T) {
+	square := func(s string) Square {
+		return Square(algebraicToIndexFatal(s))
+	}
+	pieces := map[Square]ColoredPiece{
+		square("e1"): {King, true},
+		square("e2"): {Pawn, true},
+		square("h1"): {Rook, true},
+		square("d7"): {King, false},
+		square("c5"): {Knight, false},
+	}
+	b, err := NewBoardFromPieces(pieces, true, WhiteKingside, 0)
+	if err != nil {
+		t.Fatal("Failed to construct a board from pieces:", err)
+	}
+	fen := "8/3k4/8/2n5/8/8/4P3/4K2R w K - 0 1"
+	if b.ToFen() != fen {
+		t.Error("Wrong board constructed from pieces.\nExpected", fen, "but got", b.ToFen())
+	}
+	expected := ParseFen(fen)
+	if b.Hash() != expected.Hash() || b.CurrentMaterial() != expected.CurrentMaterial() {
+		t.Error("Board constructed from pieces has an inconsistent hash or material.")
+	}
+	moves, expectedMoves := b.GenerateLegalMoves(), expected.GenerateLegalMoves()
+	SortMoves(moves)
+	SortMoves(expectedMoves)
+	if WriteUCILine(moves) != WriteUCILine(expectedMoves) {
+		t.Error("Board constructed from pieces generates different moves than its FEN.")
+	}
+	// with an en passant square, after e2e4
+	delete(pieces, square("e2"))
+	pieces[square("e4")] = ColoredPiece{Pawn, true}
+	b, err = NewBoardFromPieces(pieces, false, 0, square("e3"))
+	if err != nil || b.ToFen() != "8/3k4/8/2n5/4P3/8/8/4K2R b - e3 0 1" {
+		t.Error("Wrong board constructed with an en passant square:", b.ToFen(), err)
+	}
+	invalid := []map[Square]ColoredPiece{
+		// no kings
+		{square("e4"): {Pawn, true}},
+		// an invalid piece
+		{square("e1"): {King, true}, square("e8"): {King, false}, square("a1"): {Nothing, true}},
+		// a pawn on the last rank
+		{square("e1"): {King, true}, square("e8"): {King, false}, square("a8"): {Pawn, true}},
+	}
+	for _, p := range invalid {
+		if _, err := NewBoardFromPieces(p, true, 0, 0); err == nil {
+			t.Error("Constructed an invalid board from pieces:", p)
+		}
+	}
+	// castling rights without the rook
+	if _, err := NewBoardFromPieces(pieces, false, WhiteQueenside, 0); err == nil {
+		t.Error("Constructed a board with inconsistent castling rights.")
+	}
+}
+
+func TestGenerateLegalMovesOrdered(t *testing.T) {
+	positions := map[string]string{
+		Startpos: "b1a3 b1c3 g1f3 g1h3 a2a3 a2a4 b2b3 b2b4 c2c3 c2c4 d2d3 d2d4 e2e3 e2e4 f2f3 f2f4 g2g3 g2g4 h2h3 h2h4",
+		"4k3/1P6/8/8/8/8/8/R3K3 w Q - 0 1": "a1b1 a1c1 a1d1 a1a2 a1a3 a1a4 a1a5 a1a6 a1a7 a1a8 " +
+			"e1c1 e1d1 e1f1 e1d2 e1e2 e1f2 b7b8n b7b8b b7b8r b7b8q",
+	}
+	for fen, expected := range positions {
+		b := ParseFen(fen)
+		if moves := WriteUCILine(b.GenerateLegalMovesOrdered()); moves != expected {
+			t.Error("Wrong move order for", fen, "\nExpected", expected, "\nbut got ", moves)
+		}
+	}
+}